@@ -0,0 +1,305 @@
+// Computer opponent for tictactoe games.
+package tictactoe
+
+import (
+  "fmt"
+  "math/rand"
+)
+
+/**
+ * Finds the optimal move for the player holding game.currPiece using
+ * minimax search with alpha-beta pruning. Among equally good moves, faster
+ * wins and slower losses are preferred. Returns (-1, -1) if the board has
+ * no empty positions.
+ *
+ * The search is exhaustive, so it is only practical on small boards, and 
+ * assumes a two-player game.
+ */
+func BestMove(game *GameState) (x int, y int) {
+  game.mu.Lock()
+  search := game.clone()
+  game.mu.Unlock()
+
+  x, y = -1, -1
+  best := 0
+  alpha, beta := -searchInf, searchInf
+  for i := 0; i < search.size; i++ {
+    for j := 0; j < search.size; j++ {
+      if search.board[i][j] != B {
+        continue
+      }
+      score := scoreMove(search, i, j, alpha, beta)
+      if x < 0 || score > best {
+        x, y, best = i, j, score
+      }
+      if score > alpha {
+        alpha = score
+      }
+    }
+  }
+  return x, y
+}
+
+/**
+ * Checks if the player holding game.currPiece can force a win against any 
+ * defense, using the same exhaustive search as BestMove. Returns false if 
+ * the game is over.
+ */
+func (g *GameState) HasForcedWin() bool {
+  g.mu.Lock()
+  search := g.clone()
+  g.mu.Unlock()
+
+  if search.result != Pending {
+    return false
+  }
+  // Any positive score is a win, and the search can stop proving it once 
+  // it finds one.
+  return negamax(search, 0, 1) > 0
+}
+
+// Bound on search scores, larger than any reachable score.
+const searchInf = 1 << 30
+
+/**
+ * Scores placing game.currPiece at (x,y) from the perspective of the
+ * player making the move. A win scores 1 plus the number of cells left
+ * empty, a tie scores 0, and a loss scores the negation of the opponent's
+ * win. The game is restored before returning.
+ */
+func scoreMove(game *GameState, x int, y int, alpha int, beta int) int {
+  placePiece(game, game.currPiece, x, y)
+  defer removePiece(game, x, y)
+
+  win := 1 + game.size * game.size - game.totalPieces
+  switch checkGameOver(game, x, y) {
+  case Pending:
+  case Tie:
+    return 0
+  case winResult(game.currPiece):
+    return win
+  default:
+    // Completing a line in Misere mode loses.
+    return -win
+  }
+
+  game.currPiece = otherPiece(game.currPiece)
+  defer func() { game.currPiece = otherPiece(game.currPiece) }()
+  return -negamax(game, -beta, -alpha)
+}
+
+// Gets the best score the player holding game.currPiece can force.
+func negamax(game *GameState, alpha int, beta int) int {
+  best := -searchInf
+  for i := 0; i < game.size; i++ {
+    for j := 0; j < game.size; j++ {
+      if game.board[i][j] != B {
+        continue
+      }
+      score := scoreMove(game, i, j, alpha, beta)
+      if score > best {
+        best = score
+      }
+      if best > alpha {
+        alpha = best
+      }
+      if alpha >= beta {
+        return best
+      }
+    }
+  }
+  return best
+}
+
+/**
+ * Finds a good move for the player holding game.currPiece like BestMove, 
+ * but only searching depth moves ahead after its own, and scoring the 
+ * positions there with Evaluate. A depth of 0 picks the move that Evaluate 
+ * scores best straight away. Returns (-1, -1) if the board has no empty 
+ * positions. Like BestMove, this assumes a two-player game.
+ */
+func BestMoveDepth(game *GameState, depth int) (x int, y int) {
+  game.mu.Lock()
+  search := game.clone()
+  game.mu.Unlock()
+
+  x, y = -1, -1
+  best := 0
+  alpha, beta := -searchInf, searchInf
+  for _, m := range validMoves(search) {
+    score := scoreMoveDepth(search, m[0], m[1], depth, alpha, beta)
+    if x < 0 || score > best {
+      x, y, best = m[0], m[1], score
+    }
+    if score > alpha {
+      alpha = score
+    }
+  }
+  return x, y
+}
+
+/**
+ * Scores placing game.currPiece at (x,y) like scoreMove, searching depth 
+ * more moves ahead before falling back to Evaluate from the perspective of 
+ * the player making the move. Wins score above any Evaluate score, with 
+ * faster wins scoring higher. The game is restored before returning.
+ */
+func scoreMoveDepth(game *GameState, x int, y int, depth int, alpha int,
+    beta int) int {
+  placePiece(game, game.currPiece, x, y)
+  defer removePiece(game, x, y)
+
+  win := evalWin + game.size * game.size - game.totalPieces
+  switch checkGameOver(game, x, y) {
+  case Pending:
+  case Tie:
+    return 0
+  case winResult(game.currPiece):
+    return win
+  default:
+    // Completing a line in Misere mode loses.
+    return -win
+  }
+
+  if depth <= 0 {
+    if game.currPiece == X {
+      return -evaluate(game)
+    }
+    return evaluate(game)
+  }
+
+  game.currPiece = otherPiece(game.currPiece)
+  defer func() { game.currPiece = otherPiece(game.currPiece) }()
+  return -negamaxDepth(game, depth - 1, -beta, -alpha)
+}
+
+// Gets the best score the player holding game.currPiece can reach within 
+// depth more moves after their next one, as scored by scoreMoveDepth.
+func negamaxDepth(game *GameState, depth int, alpha int, beta int) int {
+  best := -searchInf
+  for _, m := range validMoves(game) {
+    score := scoreMoveDepth(game, m[0], m[1], depth, alpha, beta)
+    if score > best {
+      best = score
+    }
+    if best > alpha {
+      alpha = best
+    }
+    if alpha >= beta {
+      return best
+    }
+  }
+  return best
+}
+
+/**
+ * Picks a move for the current player uniformly at random among the empty 
+ * positions, using rng so that choices can be reproduced. Returns an error 
+ * if the game is over.
+ */
+func RandomMove(game *GameState, rng *rand.Rand) (x int, y int, err error) {
+  game.mu.Lock()
+  result := game.result
+  moves := validMoves(game)
+  game.mu.Unlock()
+
+  if result != Pending {
+    return -1, -1, fmt.Errorf("game result %s: %w", result, ErrGameOver)
+  }
+  m := moves[rng.Intn(len(moves))]
+  return m[0], m[1], nil
+}
+
+/**
+ * How strongly the computer opponent plays, one of:
+ * - Easy - Plays the best move 20% of the time, otherwise a random move.
+ * - Medium - Plays the best move 60% of the time, otherwise a random move.
+ * - Hard - Always plays the best move.
+ */
+type Difficulty int
+const (
+  Easy Difficulty = iota
+  Medium
+  Hard
+)
+
+// Chance of each Difficulty playing the best move rather than a random one.
+var bestMoveChance = map[Difficulty]float64{
+  Easy: 0.2,
+  Medium: 0.6,
+  Hard: 1,
+}
+
+/**
+ * Picks a move for the current player at the given difficulty, playing the 
+ * BestMove with the level's chance and a RandomMove otherwise. Uses rng for 
+ * all random choices so that they can be reproduced. Returns an error if 
+ * the game is over.
+ */
+func DifficultyMove(game *GameState, level Difficulty,
+    rng *rand.Rand) (x int, y int, err error) {
+  if rng.Float64() >= bestMoveChance[level] {
+    return RandomMove(game, rng)
+  }
+
+  if result := game.Result(); result != Pending {
+    return -1, -1, fmt.Errorf("game result %s: %w", result, ErrGameOver)
+  }
+  x, y = BestMove(game)
+  return x, y, nil
+}
+
+/**
+ * Gets every state reachable from the game in one move by the current 
+ * player, one per empty position in row-major order. Each state is an 
+ * independent copy, and the game itself is left untouched. Returns an 
+ * empty slice if the game is over or paused.
+ */
+func (g *GameState) NextStates() []*GameState {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  states := []*GameState{}
+  if g.result != Pending || g.paused {
+    return states
+  }
+  for _, m := range validMoves(g) {
+    next := g.clone()
+    applyMove(next, currPlayer(next), m[0], m[1])
+    states = append(states, next)
+  }
+  return states
+}
+
+/**
+ * Estimates the odds of each outcome by playing n games from the current 
+ * position to the end with uniformly random moves, using rng so that the 
+ * estimate can be reproduced. Returns the fractions of games won by O, won 
+ * by X, and tied, which are all zero if n is not positive. The game itself 
+ * is left untouched, and a game that is over always ends the same way.
+ */
+func (g *GameState) Rollout(n int, rng *rand.Rand) (oWin float64,
+    xWin float64, ties float64) {
+  g.mu.Lock()
+  start := g.clone()
+  g.mu.Unlock()
+  // Rollouts play on regardless of whether the game is paused.
+  start.paused = false
+
+  if n <= 0 {
+    return 0, 0, 0
+  }
+  counts := map[GameResult]int{}
+  for i := 0; i < n; i++ {
+    game := start.clone()
+    for game.result == Pending {
+      moves := validMoves(game)
+      m := moves[rng.Intn(len(moves))]
+      applyMove(game, currPlayer(game), m[0], m[1])
+    }
+    counts[game.result]++
+  }
+  total := float64(n)
+  return float64(counts[OWin]) / total, float64(counts[XWin]) / total,
+    float64(counts[Tie]) / total
+}
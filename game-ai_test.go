@@ -0,0 +1,403 @@
+package tictactoe
+
+import (
+  "errors"
+  "math/rand"
+  "reflect"
+  "testing"
+)
+
+func TestBestMoveMisereAvoidsCompletingLine(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{2, 1}, [2]int{0, 1}, [2]int{2, 2})
+
+  x, y := BestMove(game)
+  if x == 0 && y == 2 {
+    t.Fatalf("BestMove completed O's row in Misere mode")
+  }
+  if result := playMoves(t, game, [2]int{x, y}); result == XWin {
+    t.Fatalf("BestMove %d %d lost the game", x, y)
+  }
+}
+
+func TestHasForcedWinMisere(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // X can complete the middle column, which loses, or leave O to tie.
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{0, 2}, [2]int{1, 0},
+    [2]int{1, 2}, [2]int{1, 1}, [2]int{2, 0})
+  if game.HasForcedWin() {
+    t.Fatalf("HasForcedWin reported a win for X, who can only tie")
+  }
+}
+
+func TestBestMoveDepthMisereAvoidsCompletingLine(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{2, 1}, [2]int{0, 1}, [2]int{2, 2})
+
+  for depth := 0; depth <= 2; depth++ {
+    if x, y := BestMoveDepth(game, depth); x == 0 && y == 2 {
+      t.Errorf("depth %d: BestMoveDepth completed O's row in Misere mode",
+        depth)
+    }
+  }
+}
+
+func TestBestMoveTakesWin(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1})
+  if x, y := BestMove(game); x != 0 || y != 2 {
+    t.Fatalf("BestMove = %d %d, want the winning move 0 2", x, y)
+  }
+}
+
+func TestBestMoveBlocksWin(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 1}, [2]int{2, 2}, [2]int{0, 2})
+  if x, y := BestMove(game); x != 2 || y != 0 {
+    t.Fatalf("BestMove = %d %d, want the block 2 0", x, y)
+  }
+}
+
+func TestBestMoveFullBoard(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{0, 2}, [2]int{2, 0},
+    [2]int{1, 0}, [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 1}, [2]int{2, 2})
+  if x, y := BestMove(game); x != -1 || y != -1 {
+    t.Fatalf("BestMove on a full board = %d %d, want -1 -1", x, y)
+  }
+}
+
+// Gets the score of the game for the player to move with perfect play by 
+// plain minimax: 1 for a win, 0 for a tie, and -1 for a loss.
+func bruteForce(game *GameState, memo map[uint64]int) int {
+  h := game.board.Hash()
+  if score, ok := memo[h]; ok {
+    return score
+  }
+  best := -2
+  for _, m := range validMoves(game) {
+    next := game.clone()
+    applyMove(next, currPlayer(next), m[0], m[1])
+    score := 0
+    switch next.result {
+    case Pending:
+      score = -bruteForce(next, memo)
+    case winResult(game.currPiece):
+      score = 1
+    case Tie:
+    default:
+      score = -1
+    }
+    if score > best {
+      best = score
+    }
+  }
+  memo[h] = best
+  return best
+}
+
+// Plays the game out against every possible sequence of opponent moves, 
+// with ai's moves chosen by BestMove, failing the test if any BestMove is 
+// worse than the brute-force best or ai ever loses.
+func checkBestMove(t *testing.T, game *GameState, ai Piece,
+    memo map[uint64]int) {
+  if game.result != Pending {
+    if game.result == winResult(otherPiece(ai)) {
+      t.Fatalf("BestMove lost as %s:\n%s", ai, game.board)
+    }
+    return
+  }
+  if game.currPiece != ai {
+    for _, m := range validMoves(game) {
+      next := game.clone()
+      applyMove(next, currPlayer(next), m[0], m[1])
+      checkBestMove(t, next, ai, memo)
+    }
+    return
+  }
+
+  want := bruteForce(game, memo)
+  x, y := BestMove(game)
+  next := game.clone()
+  if err, _ := applyMove(next, currPlayer(next), x, y); err != nil {
+    t.Fatalf("BestMove %d %d: %v", x, y, err)
+  }
+  got := 0
+  switch next.result {
+  case Pending:
+    got = -bruteForce(next, memo)
+  case winResult(ai):
+    got = 1
+  case Tie:
+  default:
+    got = -1
+  }
+  if got != want {
+    t.Fatalf("BestMove %d %d scores %d, brute force gets %d:\n%s", x, y, got,
+      want, game.board)
+  }
+  checkBestMove(t, next, ai, memo)
+}
+
+func TestBestMoveIsOptimal(t *testing.T) {
+  userA, userB := testUsers(t)
+  memo := map[uint64]int{}
+  for _, ai := range []Piece{O, X} {
+    game, err := newGame(userA, userB, boardSize)
+    if err != nil {
+      t.Fatal(err)
+    }
+    checkBestMove(t, game, ai, memo)
+  }
+}
+
+func TestRandomMoveIsReproducible(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  var first [][2]int
+  for run := 0; run < 2; run++ {
+    rng := rand.New(rand.NewSource(42))
+    var picks [][2]int
+    for i := 0; i < 20; i++ {
+      x, y, err := RandomMove(game, rng)
+      if err != nil {
+        t.Fatal(err)
+      }
+      if game.board[x][y] != B {
+        t.Fatalf("RandomMove picked occupied cell %d %d", x, y)
+      }
+      picks = append(picks, [2]int{x, y})
+    }
+    if run == 0 {
+      first = picks
+    } else if !reflect.DeepEqual(picks, first) {
+      t.Fatalf("seeded picks %v, then %v", first, picks)
+    }
+  }
+
+  // Twenty picks among eight cells should not all land on the same one.
+  seen := map[[2]int]bool{}
+  for _, m := range first {
+    seen[m] = true
+  }
+  if len(seen) < 2 {
+    t.Fatalf("RandomMove only picked %v", first)
+  }
+}
+
+func TestRandomMoveOnFinishedGame(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  rng := rand.New(rand.NewSource(1))
+  if _, _, err := RandomMove(game, rng); !errors.Is(err, ErrGameOver) {
+    t.Fatalf("RandomMove = %v, want %v", err, ErrGameOver)
+  }
+  if _, _, err := DifficultyMove(game, Hard, rng); !errors.Is(err,
+      ErrGameOver) {
+    t.Fatalf("DifficultyMove = %v, want %v", err, ErrGameOver)
+  }
+}
+
+func TestDifficultyMove(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1})
+
+  // Hard always takes the win, and other levels sometimes miss it.
+  rng := rand.New(rand.NewSource(7))
+  for i := 0; i < 20; i++ {
+    if x, y, err := DifficultyMove(game, Hard, rng); err != nil ||
+        x != 0 || y != 2 {
+      t.Fatalf("Hard DifficultyMove = %d %d, %v, want 0 2", x, y, err)
+    }
+  }
+  misses := 0
+  for i := 0; i < 50; i++ {
+    x, y, err := DifficultyMove(game, Easy, rng)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if x != 0 || y != 2 {
+      misses++
+    }
+  }
+  if misses == 0 {
+    t.Fatal("Easy DifficultyMove never missed the win")
+  }
+
+  a, b := rand.New(rand.NewSource(3)), rand.New(rand.NewSource(3))
+  for i := 0; i < 10; i++ {
+    x1, y1, _ := DifficultyMove(game, Medium, a)
+    x2, y2, _ := DifficultyMove(game, Medium, b)
+    if x1 != x2 || y1 != y2 {
+      t.Fatalf("pick %d differs with the same seed: %d %d and %d %d", i, x1,
+        y1, x2, y2)
+    }
+  }
+}
+
+func TestNextStatesOnEmptyBoard(t *testing.T) {
+  game := startTestGame(t)
+  states := game.NextStates()
+  if len(states) != 9 {
+    t.Fatalf("%d next states, want 9", len(states))
+  }
+  for i, next := range states {
+    diffs := 0
+    for x := 0; x < 3; x++ {
+      for y := 0; y < 3; y++ {
+        if next.board[x][y] != game.board[x][y] {
+          diffs++
+          if next.board[x][y] != O || x * 3 + y != i {
+            t.Errorf("state %d has %s at %d %d", i, next.board[x][y], x, y)
+          }
+        }
+      }
+    }
+    if diffs != 1 {
+      t.Errorf("state %d differs by %d pieces, want 1", i, diffs)
+    }
+    if next.currPiece != X {
+      t.Errorf("state %d has %s to move, want %s", i, next.currPiece, X)
+    }
+  }
+  if game.totalPieces != 0 || len(game.history) != 0 {
+    t.Fatal("NextStates changed the game")
+  }
+
+  states[0].board[2][2] = X
+  if states[1].board[2][2] != B {
+    t.Fatal("next states share a board")
+  }
+}
+
+func TestNextStatesOfFinishedGame(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  if states := game.NextStates(); len(states) != 0 {
+    t.Fatalf("%d next states of a finished game, want 0", len(states))
+  }
+}
+
+func TestHasForcedWinEmptyBoard(t *testing.T) {
+  game := startTestGame(t)
+  if game.HasForcedWin() {
+    t.Fatal("HasForcedWin on an empty board, where perfect play ties")
+  }
+}
+
+func TestHasForcedWinFork(t *testing.T) {
+  game := startTestGame(t)
+  // O can fork at 2 0, threatening both the first column and anti-diagonal.
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 2})
+  if !game.HasForcedWin() {
+    t.Fatal("HasForcedWin missed O's fork")
+  }
+  playMoves(t, game, [2]int{2, 0})
+  if game.HasForcedWin() {
+    t.Fatal("HasForcedWin for X, who faces two threats")
+  }
+}
+
+func TestRolloutNearWonPosition(t *testing.T) {
+  game := startTestGame(t)
+  // O to move with two ways to complete a line.
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 2},
+    [2]int{2, 0}, [2]int{1, 2})
+  before := game.Clone()
+
+  oWin, xWin, ties := game.Rollout(1000, rand.New(rand.NewSource(1)))
+  if oWin < 0.6 || oWin <= xWin {
+    t.Fatalf("O wins %.2f and X %.2f of rollouts, want O clearly ahead",
+      oWin, xWin)
+  }
+  if sum := oWin + xWin + ties; sum < 0.999 || sum > 1.001 {
+    t.Fatalf("outcome fractions sum to %f", sum)
+  }
+  if diffs := Diff(game, before); len(diffs) != 0 {
+    t.Fatalf("Rollout changed the game: %v", diffs)
+  }
+
+  again, _, _ := game.Rollout(1000, rand.New(rand.NewSource(1)))
+  if again != oWin {
+    t.Fatalf("seeded rollouts gave %f, then %f", oWin, again)
+  }
+}
+
+func TestRolloutFinishedGame(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  rng := rand.New(rand.NewSource(1))
+  if oWin, xWin, ties := game.Rollout(10, rng); oWin != 1 || xWin != 0 ||
+      ties != 0 {
+    t.Fatalf("Rollout of an O win = %f, %f, %f", oWin, xWin, ties)
+  }
+  if oWin, xWin, ties := game.Rollout(0, rng); oWin != 0 || xWin != 0 ||
+      ties != 0 {
+    t.Fatalf("Rollout(0) = %f, %f, %f, want all 0", oWin, xWin, ties)
+  }
+}
+
+// Gets the brute-force score of the current player making the move x y.
+func moveScore(game *GameState, x, y int, memo map[uint64]int) int {
+  next := game.clone()
+  applyMove(next, currPlayer(next), x, y)
+  switch next.result {
+  case Pending:
+    return -bruteForce(next, memo)
+  case winResult(game.currPiece):
+    return 1
+  case Tie:
+    return 0
+  }
+  return -1
+}
+
+func TestBestMoveDepthSeesPastGreedyChoice(t *testing.T) {
+  game := startTestGame(t)
+  // X must answer on an edge, since a corner lets O fork.
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 1}, [2]int{2, 2})
+  memo := map[uint64]int{}
+
+  // The greedy choice takes a corner, which only search shows to lose.
+  greedyX, greedyY := BestMoveDepth(game, 0)
+  if score := moveScore(game, greedyX, greedyY, memo); score != -1 {
+    t.Fatalf("depth 0: %d %d scores %d, so the position no longer tells " +
+      "depths apart", greedyX, greedyY, score)
+  }
+  for depth := 1; depth <= 4; depth++ {
+    x, y := BestMoveDepth(game, depth)
+    if score := moveScore(game, x, y, memo); score != 0 {
+      t.Errorf("depth %d: %d %d scores %d, want a move that holds the tie",
+        depth, x, y, score)
+    }
+  }
+}
+
+func TestBestMoveDepthTakesForcedWin(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 2})
+  memo := map[uint64]int{}
+  for depth := 1; depth <= 4; depth++ {
+    x, y := BestMoveDepth(game, depth)
+    if score := moveScore(game, x, y, memo); score != 1 {
+      t.Errorf("depth %d: %d %d scores %d, want a forced win", depth, x, y,
+        score)
+    }
+  }
+}
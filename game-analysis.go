@@ -0,0 +1,321 @@
+// Position analysis helpers for tictactoe games.
+package tictactoe
+
+// Gets the row, column, and diagonal counts of the player owning piece p.
+func countsFor(game *GameState, p Piece) *PlayerCounts {
+  return &game.counts[p]
+}
+
+/**
+ * Checks if placing piece p on the empty position (x,y) would complete a
+ * line. Since the position is empty, a full length line through it 
+ * completes exactly when the player already has size - 1 pieces in that 
+ * line.
+ */
+func completesLine(game *GameState, p Piece, x int, y int) bool {
+  if game.winLength < game.size {
+    // Runs shorter than the board aren't tracked by the counts, so try the 
+    // move and scan for one instead.
+    placePiece(game, p, x, y)
+    defer removePiece(game, x, y)
+    return completedRun(game, x, y) != nil
+  }
+
+  counts := countsFor(game, p)
+  need := game.size - 1
+  onMain, onAnti := getDiag(x, y, game.size)
+  return counts.rows[x] == need || counts.cols[y] == need ||
+    onMain && counts.diags[0] == need || onAnti && counts.diags[1] == need
+}
+
+/**
+ * Gets all empty positions (x,y), in row-major order, where placing the
+ * current player's piece immediately wins the game. In Misere mode 
+ * completing a line loses instead, so only the game's win conditions can 
+ * give winning moves.
+ */
+func (g *GameState) WinningMoves() [][2]int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return winningMoves(g, g.currPiece)
+}
+
+/**
+ * Gets all empty positions (x,y), in row-major order, where placing piece p 
+ * would complete a line, whether or not it is p's turn. This shows the 
+ * opponent's threats as well as the current player's winning moves. In 
+ * Misere mode these are the cells p must avoid, since completing a line 
+ * loses.
+ */
+func (g *GameState) Threats(p Piece) [][2]int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  if p < 0 || int(p) >= len(g.players) {
+    return [][2]int{}
+  }
+  return threats(g, p)
+}
+
+/**
+ * Gets all empty positions (x,y), in row-major order, where placing the 
+ * current player's piece would leave them two or more WinningMoves at 
+ * once, so that the opponent cannot block them all. Moves that end the 
+ * game straight away are not included, and in Misere mode, where 
+ * completing a line loses, there are none.
+ */
+func (g *GameState) ForkMoves() [][2]int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  forks := [][2]int{}
+  p := g.currPiece
+  for _, m := range validMoves(g) {
+    if moveResult(g, p, m[0], m[1]) != Pending {
+      continue
+    }
+    placePiece(g, p, m[0], m[1])
+    if len(winningMoves(g, p)) >= 2 {
+      forks = append(forks, m)
+    }
+    removePiece(g, m[0], m[1])
+  }
+  return forks
+}
+
+func threats(game *GameState, p Piece) [][2]int {
+  moves := [][2]int{}
+  for _, m := range validMoves(game) {
+    if completesLine(game, p, m[0], m[1]) {
+      moves = append(moves, m)
+    }
+  }
+  return moves
+}
+
+// Gets the empty positions where placing piece p wins the game for p under 
+// the game's mode and win conditions.
+func winningMoves(game *GameState, p Piece) [][2]int {
+  moves := [][2]int{}
+  for _, m := range validMoves(game) {
+    if moveResult(game, p, m[0], m[1]) == winResult(p) {
+      moves = append(moves, m)
+    }
+  }
+  return moves
+}
+
+// Gets the result of placing piece p on the empty position (x,y), leaving 
+// the game as it was.
+func moveResult(game *GameState, p Piece, x int, y int) GameResult {
+  placePiece(game, p, x, y)
+  defer removePiece(game, x, y)
+  return checkGameOver(game, x, y)
+}
+
+// Gets the number of pieces the player holding piece p has placed, which 
+// is the sum of their row counts.
+func (g *GameState) PieceCount(p Piece) int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if p < 0 || int(p) >= len(g.players) {
+    return 0
+  }
+  total := 0
+  for _, n := range countsFor(g, p).rows {
+    total += n
+  }
+  return total
+}
+
+/**
+ * Counts the rows, columns, and diagonals that hold none of the opponents' 
+ * pieces, and so can still be completed by the player holding piece p.
+ */
+func openLines(game *GameState, p Piece) int {
+  // Sum the opponents' counts so a line is open when its sum is zero.
+  opp := newPlayerCounts(game.size)
+  for i := range game.counts {
+    if Piece(i) == p {
+      continue
+    }
+    for j := 0; j < game.size; j++ {
+      opp.rows[j] += game.counts[i].rows[j]
+      opp.cols[j] += game.counts[i].cols[j]
+    }
+    opp.diags[0] += game.counts[i].diags[0]
+    opp.diags[1] += game.counts[i].diags[1]
+  }
+
+  open := 0
+  for i := 0; i < game.size; i++ {
+    if opp.rows[i] == 0 {
+      open++
+    }
+    if opp.cols[i] == 0 {
+      open++
+    }
+  }
+  for _, n := range opp.diags {
+    if n == 0 {
+      open++
+    }
+  }
+  return open
+}
+
+/**
+ * Gets the number of rows, columns, and diagonals holding no opponent 
+ * pieces, which the player holding piece p can still complete. Only full 
+ * length lines are counted, so on an empty board all 2 * size + 2 are open.
+ */
+func (g *GameState) OpenLines(p Piece) int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  if p < 0 || int(p) >= len(g.players) {
+    return 0
+  }
+  return openLines(g, p)
+}
+
+/**
+ * Checks if the game can only end in a tie. This is the case once every 
+ * row, column, and diagonal holds pieces of more than one player, even if 
+ * empty positions remain, or once the game has ended in a tie.
+ */
+func (g *GameState) IsDrawn() bool {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  switch g.result {
+  case Tie:
+    return true
+  case Pending:
+    // Open lines only cover full length lines, so shorter runs can't be 
+    // ruled out this way.
+    if g.winLength < g.size {
+      return false
+    }
+    for i := range g.players {
+      if openLines(g, Piece(i)) > 0 {
+        return false
+      }
+    }
+    return true
+  }
+  return false
+}
+
+// Score Evaluate gives a position won by O, and the negation for X, larger 
+// than any heuristic score.
+const evalWin = 1 << 20
+
+/**
+ * Gets a heuristic score of the position from O's perspective, positive if 
+ * it favors O and negative if it favors X. Each line still open to only one 
+ * of them scores the square of their pieces in it, and a line they are one 
+ * piece from completing scores size * size more. Won positions score 
+ * evalWin for O and -evalWin for X, while ties and wins for T score 0. 
+ * Only full length lines are considered.
+ */
+func (g *GameState) Evaluate() int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return evaluate(g)
+}
+
+// Scores the position like Evaluate, for callers already holding game.mu.
+func evaluate(g *GameState) int {
+  switch g.result {
+  case OWin:
+    return evalWin
+  case XWin:
+    return -evalWin
+  case Pending:
+  default:
+    return 0
+  }
+
+  score := 0
+  counts := make([]int, len(g.counts))
+  for line := 0; line < 2 * g.size + 2; line++ {
+    for p := range g.counts {
+      c := &g.counts[p]
+      switch {
+      case line < g.size:
+        counts[p] = c.rows[line]
+      case line < 2 * g.size:
+        counts[p] = c.cols[line - g.size]
+      default:
+        counts[p] = c.diags[line - 2 * g.size]
+      }
+    }
+    score += evalLine(g.size, counts)
+  }
+  return score
+}
+
+/**
+ * Scores a single line for Evaluate given each player's number of pieces in 
+ * it, indexed by piece. Lines holding pieces of more than one player can't 
+ * be completed and score 0.
+ */
+func evalLine(size int, counts []int) int {
+  owner, n := B, 0
+  for p, m := range counts {
+    if m == 0 {
+      continue
+    }
+    if owner != B {
+      return 0
+    }
+    owner, n = Piece(p), m
+  }
+
+  s := n * n
+  if n == size - 1 {
+    s += size * size
+  }
+  switch owner {
+  case O:
+    return s
+  case X:
+    return -s
+  }
+  return 0
+}
+
+/**
+ * Gets a positional score for the player holding piece p from the cells 
+ * they occupy: size for each center cell, size - 1 for each corner, and 1 
+ * for every other cell. Boards of even size have four center cells.
+ */
+func (g *GameState) CenterControl(p Piece) int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if p == B {
+    return 0
+  }
+  size := g.size
+  // The center cells span rows and columns lo through hi, which are equal 
+  // on boards of odd size.
+  lo, hi := (size - 1) / 2, size / 2
+  score := 0
+  for i := 0; i < size; i++ {
+    for j := 0; j < size; j++ {
+      if g.board[i][j] != p {
+        continue
+      }
+      switch {
+      case i >= lo && i <= hi && j >= lo && j <= hi:
+        score += size
+      case (i == 0 || i == size - 1) && (j == 0 || j == size - 1):
+        score += size - 1
+      default:
+        score++
+      }
+    }
+  }
+  return score
+}
@@ -0,0 +1,231 @@
+package tictactoe
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestWinningMoves(t *testing.T) {
+  game := startTestGame(t)
+  if moves := game.WinningMoves(); len(moves) != 0 {
+    t.Fatalf("winning moves on an empty board: %v", moves)
+  }
+
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{2, 2})
+  want := [][2]int{{0, 2}}
+  if moves := game.WinningMoves(); !reflect.DeepEqual(moves, want) {
+    t.Fatalf("winning moves %v, want %v", moves, want)
+  }
+}
+
+func TestWinningMovesMisere(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{2, 2})
+  if moves := game.WinningMoves(); len(moves) != 0 {
+    t.Fatalf("winning moves %v in Misere mode", moves)
+  }
+  want := [][2]int{{0, 2}}
+  if moves := game.Threats(O); !reflect.DeepEqual(moves, want) {
+    t.Fatalf("Threats(O) = %v, want %v", moves, want)
+  }
+  if result := playMoves(t, game, [2]int{0, 2}); result != XWin {
+    t.Fatalf("completing O's row gave %s, want %s", result, XWin)
+  }
+}
+
+func TestWinningMovesSeveral(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{1, 1}, [2]int{2, 1},
+    [2]int{0, 1}, [2]int{1, 2})
+  want := [][2]int{{0, 2}, {2, 2}}
+  if moves := game.WinningMoves(); !reflect.DeepEqual(moves, want) {
+    t.Fatalf("winning moves %v, want %v", moves, want)
+  }
+}
+
+func TestPieceCountSumsToTotal(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{2, 2}, [2]int{0, 2},
+    [2]int{0, 1})
+
+  o, x := game.PieceCount(O), game.PieceCount(X)
+  if o != 3 || x != 2 {
+    t.Fatalf("piece counts O %d, X %d, want 3 and 2", o, x)
+  }
+  if o + x != game.totalPieces {
+    t.Fatalf("piece counts add up to %d, total pieces %d", o + x,
+      game.totalPieces)
+  }
+  if n := game.PieceCount(T); n != 0 {
+    t.Fatalf("piece count %d for a piece not in the game", n)
+  }
+}
+
+func TestIsDrawnWithCellsLeft(t *testing.T) {
+  game := startTestGame(t)
+  if game.IsDrawn() {
+    t.Fatal("empty board reported drawn")
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{0, 2}, [2]int{1, 1},
+    [2]int{1, 0}, [2]int{1, 2}, [2]int{2, 1})
+  if game.IsDrawn() {
+    t.Fatal("reported drawn while X can still complete a line")
+  }
+
+  // Every line now holds both pieces, with 2 2 still empty.
+  playMoves(t, game, [2]int{2, 0})
+  if !game.IsDrawn() {
+    t.Fatalf("blocked position not reported drawn:\n%s", game.board)
+  }
+  if n := game.RemainingCells(); n != 1 {
+    t.Fatalf("%d cells left, want 1", n)
+  }
+}
+
+func TestEvaluateSign(t *testing.T) {
+  game := startTestGame(t)
+  if score := game.Evaluate(); score != 0 {
+    t.Fatalf("empty board scores %d, want 0", score)
+  }
+
+  // O threatens the first row and X holds nothing of value.
+  playMoves(t, game, [2]int{0, 0}, [2]int{2, 1}, [2]int{0, 1})
+  if score := game.Evaluate(); score <= 0 {
+    t.Fatalf("O's position scores %d, want a positive score", score)
+  }
+
+  userA, userB := testUsers(t)
+  other, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, other, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 1}, [2]int{0, 0})
+  if score := other.Evaluate(); score >= 0 {
+    t.Fatalf("X's position scores %d, want a negative score", score)
+  }
+}
+
+func TestEvaluateWonPositions(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  if score := game.Evaluate(); score != evalWin {
+    t.Fatalf("O win scores %d, want %d", score, evalWin)
+  }
+
+  userA, userB := testUsers(t)
+  other, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, other, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{2, 2}, [2]int{1, 2})
+  if score := other.Evaluate(); score != -evalWin {
+    t.Fatalf("X win scores %d, want %d", score, -evalWin)
+  }
+}
+
+func TestThreats(t *testing.T) {
+  game := startTestGame(t)
+  for _, p := range []Piece{O, X} {
+    if threats := game.Threats(p); len(threats) != 0 {
+      t.Fatalf("%s threatens %v on an empty board", p, threats)
+    }
+  }
+
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 2},
+    [2]int{1, 0})
+  want := [][2]int{{0, 2}, {2, 0}}
+  if got := game.Threats(O); !reflect.DeepEqual(got, want) {
+    t.Fatalf("O threatens %v, want %v", got, want)
+  }
+  want = [][2]int{{0, 2}}
+  if got := game.Threats(X); !reflect.DeepEqual(got, want) {
+    t.Fatalf("X threatens %v, want %v", got, want)
+  }
+}
+
+func TestOpenLines(t *testing.T) {
+  game := startTestGame(t)
+  for _, p := range []Piece{O, X} {
+    if n := game.OpenLines(p); n != 8 {
+      t.Fatalf("%s has %d open lines on an empty board, want 8", p, n)
+    }
+  }
+
+  // The center blocks four of X's lines, and the corner three of O's.
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0})
+  if n := game.OpenLines(O); n != 5 {
+    t.Fatalf("O has %d open lines, want 5", n)
+  }
+  if n := game.OpenLines(X); n != 4 {
+    t.Fatalf("X has %d open lines, want 4", n)
+  }
+}
+
+func TestCenterControl(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{2, 2}, [2]int{0, 1},
+    [2]int{1, 2})
+  // O holds the center, a corner, and an edge, and X a corner and an edge.
+  if score := game.CenterControl(O); score != 3 + 2 + 1 {
+    t.Fatalf("O scores %d, want 6", score)
+  }
+  if score := game.CenterControl(X); score != 2 + 1 {
+    t.Fatalf("X scores %d, want 3", score)
+  }
+  if score := game.CenterControl(B); score != 0 {
+    t.Fatalf("blanks score %d, want 0", score)
+  }
+}
+
+func TestCenterControlScalesWithSize(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWithSize(userA, userB, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // Each of the four center cells is worth 4 and each corner 3.
+  playMoves(t, game, [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 1}, [2]int{3, 0},
+    [2]int{0, 0})
+  if score := game.CenterControl(O); score != 4 + 4 + 3 {
+    t.Fatalf("O scores %d, want 11", score)
+  }
+  if score := game.CenterControl(X); score != 1 + 3 {
+    t.Fatalf("X scores %d, want 4", score)
+  }
+}
+
+func TestForkMoves(t *testing.T) {
+  game := startTestGame(t)
+  if forks := game.ForkMoves(); len(forks) != 0 {
+    t.Fatalf("forks %v on an empty board", forks)
+  }
+
+  // O holds a corner and the center, so either cell below the corner 
+  // threatens two lines at once.
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 2})
+  want := [][2]int{{1, 0}, {2, 0}}
+  if forks := game.ForkMoves(); !reflect.DeepEqual(forks, want) {
+    t.Fatalf("ForkMoves() = %v, want %v", forks, want)
+  }
+  if game.totalPieces != 4 || game.board[1][0] != B || game.board[2][0] != B {
+    t.Fatal("ForkMoves changed the board")
+  }
+}
+
+func TestForkMovesMisere(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 2})
+  if forks := game.ForkMoves(); len(forks) != 0 {
+    t.Fatalf("forks %v in Misere mode", forks)
+  }
+}
@@ -0,0 +1,53 @@
+// Interactive text-based play of tictactoe games, e.g. for local demos.
+package tictactoe
+
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "strings"
+)
+
+/**
+ * Plays a game between two players sharing r and w, such as a terminal.
+ * Each turn renders the board and prompts the current player for a move
+ * like "B2", read one per line from r, until the game is over, and then
+ * announces the result. Invalid moves are reported and prompted again. The
+ * game is abandoned if r runs out of input first. The game is not stored
+ * in currentGames.
+ */
+func PlayCLI(r io.Reader, w io.Writer) {
+  game, _ := newGame("Player 1", "Player 2", boardSize)
+  in := bufio.NewScanner(r)
+
+  result := Pending
+  for result == Pending {
+    user, piece := game.CurrentPlayer()
+    fmt.Fprintf(w, "%s\n%s (%s), enter a move like B2: ", boardOf(game),
+      user, piece)
+    if !in.Scan() {
+      fmt.Fprintln(w, "\nGame abandoned.")
+      return
+    }
+
+    var err error
+    err, result = MakeMoveCoord(game, user, strings.TrimSpace(in.Text()))
+    if err != nil {
+      fmt.Fprintf(w, "Invalid move: %s\n", err)
+    }
+  }
+
+  fmt.Fprintf(w, "%s\n", boardOf(game))
+  if winner, ok := game.WinnerUser(); ok {
+    fmt.Fprintf(w, "%s wins!\n", winner)
+  } else {
+    fmt.Fprintln(w, "It's a tie!")
+  }
+}
+
+// Gets a copy of the game's board.
+func boardOf(game *GameState) Board {
+  game.mu.Lock()
+  defer game.mu.Unlock()
+  return game.board.clone()
+}
@@ -0,0 +1,51 @@
+package tictactoe
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestPlayCLIWin(t *testing.T) {
+  var out strings.Builder
+  PlayCLI(strings.NewReader("A1\nA2\nB1\nB2\nC1\n"), &out)
+
+  s := out.String()
+  if !strings.HasSuffix(s, " O | O | O \n" +
+      "---+---+---\n" +
+      " X | X | . \n" +
+      "---+---+---\n" +
+      " . | . | . \n" +
+      "\nPlayer 1 wins!\n") {
+    t.Fatalf("output does not end with the final board and winner:\n%s", s)
+  }
+  if n := strings.Count(s, "enter a move"); n != 5 {
+    t.Fatalf("%d prompts, want 5:\n%s", n, s)
+  }
+  if !strings.Contains(s, "Player 2 (X), enter a move like B2: ") {
+    t.Fatalf("second player never prompted:\n%s", s)
+  }
+}
+
+func TestPlayCLIInvalidMoves(t *testing.T) {
+  var out strings.Builder
+  PlayCLI(strings.NewReader("B2\nB2\nZ9\n  a1  \n"), &out)
+
+  s := out.String()
+  if n := strings.Count(s, "Invalid move: "); n != 2 {
+    t.Fatalf("%d invalid moves reported, want 2:\n%s", n, s)
+  }
+  if !strings.HasSuffix(s, "\nGame abandoned.\n") {
+    t.Fatalf("game not abandoned at the end of input:\n%s", s)
+  }
+  if !strings.Contains(s, " X | . | . \n") {
+    t.Fatalf("padded move a1 not played:\n%s", s)
+  }
+}
+
+func TestPlayCLITie(t *testing.T) {
+  var out strings.Builder
+  PlayCLI(strings.NewReader("B2\nA1\nC1\nA3\nA2\nC2\nB1\nB3\nC3\n"), &out)
+  if s := out.String(); !strings.HasSuffix(s, "It's a tie!\n") {
+    t.Fatalf("tie not announced:\n%s", s)
+  }
+}
@@ -0,0 +1,62 @@
+// Chess-clock style time budgets for tictactoe games.
+package tictactoe
+
+import (
+  "time"
+)
+
+// Gives every player of the game a clock with budget time left, replacing 
+// any time they had left before.
+func (g *GameState) SetClock(budget time.Duration) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  g.remaining = map[Piece]time.Duration{}
+  for i := range g.players {
+    g.remaining[Piece(i)] = budget
+  }
+}
+
+// Gets the time left on the clock of the player holding piece p, which is 
+// zero if the game is untimed.
+func (g *GameState) TimeRemaining(p Piece) time.Duration {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return g.remaining[p]
+}
+
+func cloneClock(remaining map[Piece]time.Duration) map[Piece]time.Duration {
+  if remaining == nil {
+    return nil
+  }
+  clock := make(map[Piece]time.Duration, len(remaining))
+  for p, d := range remaining {
+    clock[p] = d
+  }
+  return clock
+}
+
+/**
+ * Makes a move like makeMove, first taking elapsed, the time user spent on 
+ * the move, off their clock. If that uses up their time, no piece is placed 
+ * and user forfeits, so an error wrapping ErrOutOfTime is returned along 
+ * with a win for the player after them in turn order. As with Forfeit, 
+ * this is not counted in user statistics. Untimed games ignore elapsed.
+ */
+func MakeTimedMove(game *GameState, user string, x int, y int,
+    elapsed time.Duration) (error, GameResult) {
+  return runMove(game, func() (error, GameResult) {
+    if err := validateMove(game, user, x, y); err != nil {
+      return err, game.result
+    }
+
+    if game.remaining != nil {
+      game.remaining[game.currPiece] -= elapsed
+      if game.remaining[game.currPiece] <= 0 {
+        game.remaining[game.currPiece] = 0
+        game.result = winResult(nextPiece(game, game.currPiece))
+        return newMoveError(ErrOutOfTime, "player " + user), game.result
+      }
+    }
+    return applyMove(game, user, x, y)
+  })
+}
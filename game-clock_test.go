@@ -0,0 +1,61 @@
+package tictactoe
+
+import (
+  "errors"
+  "testing"
+  "time"
+)
+
+func TestMakeTimedMoveTakesTime(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  game.SetClock(time.Minute)
+
+  if err, _ := MakeTimedMove(game, userA, 1, 1, 20 * time.Second); err != nil {
+    t.Fatal(err)
+  }
+  if left := game.TimeRemaining(O); left != 40 * time.Second {
+    t.Fatalf("O has %v left, want 40s", left)
+  }
+  if left := game.TimeRemaining(X); left != time.Minute {
+    t.Fatalf("X has %v left, want 1m", left)
+  }
+}
+
+func TestMakeTimedMoveOutOfTimeForfeits(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  game.SetClock(time.Minute)
+  if err, _ := MakeTimedMove(game, userA, 1, 1, 50 * time.Second); err != nil {
+    t.Fatal(err)
+  }
+  if err, _ := MakeTimedMove(game, userB, 0, 0, 10 * time.Second); err != nil {
+    t.Fatal(err)
+  }
+
+  err, result := MakeTimedMove(game, userA, 0, 2, 10 * time.Second)
+  if !errors.Is(err, ErrOutOfTime) || result != XWin {
+    t.Fatalf("MakeTimedMove = %v, %s, want %v and %s", err, result,
+      ErrOutOfTime, XWin)
+  }
+  if left := game.TimeRemaining(O); left != 0 {
+    t.Fatalf("O has %v left, want 0", left)
+  }
+  if game.board[0][2] != B || game.totalPieces != 2 {
+    t.Fatal("move that ran out of time placed a piece")
+  }
+  if err, _ := makeMove(game, userB, 2, 2); !errors.Is(err, ErrGameOver) {
+    t.Fatalf("move after forfeit = %v, want %v", err, ErrGameOver)
+  }
+}
+
+func TestMakeTimedMoveUntimed(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  if err, _ := MakeTimedMove(game, userA, 1, 1, time.Hour); err != nil {
+    t.Fatal(err)
+  }
+  if left := game.TimeRemaining(O); left != 0 {
+    t.Fatalf("untimed game has %v left, want 0", left)
+  }
+}
@@ -0,0 +1,208 @@
+// Chess-like coordinate notation for tictactoe moves.
+package tictactoe
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+/**
+ * Parses a coordinate like "B2", a column letter followed by a 1-based row 
+ * number, into the zero-based board position (x,y) where x is the row and 
+ * y the column. Letters may be upper or lower case. The position must lie 
+ * on a default boardSize board.
+ */
+func ParseCoord(s string) (x int, y int, err error) {
+  return parseCoord(s, boardSize)
+}
+
+// Parses a coordinate like ParseCoord for a size * size board.
+func parseCoord(s string, size int) (x int, y int, err error) {
+  x, y, err = splitCoord(s)
+  if err != nil {
+    return 0, 0, err
+  }
+  if !onBoard(size, x, y) {
+    return 0, 0, fmt.Errorf("coordinate %q: %w", s, ErrOutOfRange)
+  }
+  return x, y, nil
+}
+
+// Parses a coordinate like ParseCoord without checking that it lies on a 
+// board.
+func splitCoord(s string) (x int, y int, err error) {
+  if len(s) < 2 {
+    return 0, 0, fmt.Errorf("Malformed coordinate %q.", s)
+  }
+
+  col := s[0]
+  switch {
+  case col >= 'A' && col <= 'Z':
+    y = int(col - 'A')
+  case col >= 'a' && col <= 'z':
+    y = int(col - 'a')
+  default:
+    return 0, 0, fmt.Errorf("Malformed coordinate %q.", s)
+  }
+
+  row, err := strconv.Atoi(s[1:])
+  if err != nil || s[1] < '0' || s[1] > '9' {
+    return 0, 0, fmt.Errorf("Malformed coordinate %q.", s)
+  }
+  return row - 1, y, nil
+}
+
+// Formats the board position (x,y) as a coordinate like "b2", the inverse 
+// of parseCoord.
+func formatCoord(x int, y int) string {
+  return fmt.Sprintf("%c%d", 'a' + y, x + 1)
+}
+
+/**
+ * Makes a move like makeMove, with the position given as a coordinate like 
+ * "B2". A malformed coordinate is reported before anything else, as a 
+ * *MoveError wrapping ErrMalformedCoord, but one off the board is left for 
+ * makeMove to check in its usual order.
+ */
+func MakeMoveCoord(game *GameState, user string, coord string) (error,
+    GameResult) {
+  x, y, err := splitCoord(coord)
+  if err != nil {
+    return newMoveError(ErrMalformedCoord, "coordinate " +
+      strconv.Quote(coord)), game.Result()
+  }
+  return makeMove(game, user, x, y)
+}
+
+// Names of the game modes in exported moves.
+var modeNames = map[GameMode]string{Normal: "normal", Misere: "misere"}
+
+/**
+ * Exports the move history as space separated tokens of the piece moved 
+ * and its coordinate, e.g. "O:a1 X:b2 O:c3". Forced moves placed by 
+ * ForceMove are separated by "!" rather than ":", e.g. "X!c1". Games that 
+ * differ from the defaults start with tokens giving their board size, win 
+ * length, and mode, e.g. "size=5 win=4 mode=misere O:c3". Win conditions 
+ * are not exported.
+ */
+func (g *GameState) ExportMoves() string {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  tokens := []string{}
+  if g.size != boardSize {
+    tokens = append(tokens, fmt.Sprintf("size=%d", g.size))
+  }
+  if g.winLength != g.size {
+    tokens = append(tokens, fmt.Sprintf("win=%d", g.winLength))
+  }
+  if g.mode != Normal {
+    tokens = append(tokens, "mode=" + modeNames[g.mode])
+  }
+  for _, m := range g.history {
+    sep := ":"
+    if m.Forced {
+      sep = "!"
+    }
+    tokens = append(tokens, DefaultPieceCodec.EncodePiece(m.Piece) + sep +
+      formatCoord(m.X, m.Y))
+  }
+  return strings.Join(tokens, " ")
+}
+
+/**
+ * Creates a game between userA (playing O) and userB (playing X) by 
+ * replaying moves exported by ExportMoves, with forced moves placed like 
+ * ForceMove. The game is played on the default boardSize board in Normal 
+ * mode unless the leading tokens say otherwise. Returns an error if a 
+ * token is malformed, a move is illegal, or any other move is made out of 
+ * turn. Overrides the previous game if one already exists. Moves that 
+ * finish the game leave it released like LoadGame.
+ */
+func ImportMoves(userA string, userB string, s string) (*GameState, error) {
+  tokens := strings.Fields(s)
+  size, winLength, mode := boardSize, 0, Normal
+  for len(tokens) > 0 && strings.Contains(tokens[0], "=") {
+    key, value, _ := strings.Cut(tokens[0], "=")
+    var err error
+    switch key {
+    case "size":
+      size, err = strconv.Atoi(value)
+    case "win":
+      winLength, err = strconv.Atoi(value)
+    case "mode":
+      err = fmt.Errorf("Unknown mode %q.", value)
+      for m, name := range modeNames {
+        if name == value {
+          mode, err = m, nil
+        }
+      }
+    default:
+      err = fmt.Errorf("Unknown setting %q.", key)
+    }
+    if err != nil {
+      return nil, fmt.Errorf("setting %q: %w", tokens[0], err)
+    }
+    tokens = tokens[1:]
+  }
+
+  game, err := newGame(userA, userB, size)
+  if err != nil {
+    return nil, err
+  }
+  if winLength != 0 {
+    if winLength < minBoardSize || winLength > size {
+      return nil, fmt.Errorf("Win length %d must be between %d and the " +
+        "board size %d.", winLength, minBoardSize, size)
+    }
+    game.winLength = winLength
+  }
+  game.mode = mode
+
+  for i, token := range tokens {
+    name, coord, ok := strings.Cut(token, ":")
+    forced := false
+    if !ok {
+      name, coord, forced = strings.Cut(token, "!")
+    }
+    if !ok && !forced {
+      return nil, fmt.Errorf("Malformed move %q.", token)
+    }
+    piece, err := DefaultPieceCodec.DecodePiece(name)
+    if err != nil {
+      return nil, err
+    }
+    x, y, err := parseCoord(coord, game.size)
+    if err != nil {
+      return nil, err
+    }
+    if forced {
+      if err := forceMove(game, piece, x, y); err != nil {
+        return nil, fmt.Errorf("move %d: %w", i + 1, err)
+      }
+      continue
+    }
+    if piece != game.currPiece {
+      return nil, fmt.Errorf("move %d: %w", i + 1, ErrNotYourTurn)
+    }
+    if err, _ := applyMove(game, currPlayer(game), x, y); err != nil {
+      return nil, fmt.Errorf("move %d: %w", i + 1, err)
+    }
+  }
+
+  storeRebuiltGame(game)
+  return game, nil
+}
+
+/**
+ * Makes a move like makeMove, with the position given as a row-major index 
+ * from 0 to size * size - 1, so that index 4 is the center of a 3x3 board. 
+ * An index outside that range is reported as an ErrOutOfRange position.
+ */
+func (g *GameState) MakeMoveIndex(user string, idx int) (error, GameResult) {
+  size := g.Size()
+  // Division truncates towards zero, so a negative index always leaves 
+  // one of x and y negative and off the board.
+  return makeMove(g, user, idx / size, idx % size)
+}
@@ -0,0 +1,214 @@
+package tictactoe
+
+import (
+  "errors"
+  "reflect"
+  "testing"
+)
+
+func TestExportImportForcedMoves(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  if err := game.ForceMove(O, 0, 0); err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{2, 2})
+
+  exported := game.ExportMoves()
+  if want := "O:b2 O!a1 X:c3"; exported != want {
+    t.Fatalf("ExportMoves = %q, want %q", exported, want)
+  }
+  userA, userB := testUsers(t)
+  imported, err := ImportMoves(userA, userB, exported)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if got, want := imported.History(), game.History(); !reflect.DeepEqual(got,
+      want) {
+    t.Fatalf("imported history %v, want %v", got, want)
+  }
+}
+
+func TestParseCoord(t *testing.T) {
+  for _, c := range []struct {
+    s string
+    x, y int
+  }{
+    {"A1", 0, 0},
+    {"B2", 1, 1},
+    {"C1", 0, 2},
+    {"A3", 2, 0},
+    {"c3", 2, 2},
+    {"b1", 0, 1},
+  } {
+    x, y, err := ParseCoord(c.s)
+    if err != nil || x != c.x || y != c.y {
+      t.Errorf("ParseCoord(%q) = %d, %d, %v, want %d, %d", c.s, x, y, err,
+        c.x, c.y)
+    }
+  }
+}
+
+func TestParseCoordInvalid(t *testing.T) {
+  for _, s := range []string{"", "A", "1A", "AA", "A-1", "A+1", "?1", "B2x"} {
+    if x, y, err := ParseCoord(s); err == nil {
+      t.Errorf("ParseCoord(%q) = %d, %d, want an error", s, x, y)
+    }
+  }
+  for _, s := range []string{"D1", "A4", "A0", "z9"} {
+    if _, _, err := ParseCoord(s); !errors.Is(err, ErrOutOfRange) {
+      t.Errorf("ParseCoord(%q): got %v, want ErrOutOfRange", s, err)
+    }
+  }
+}
+
+func TestMakeMoveCoord(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  if err, _ := MakeMoveCoord(game, userA, "b2"); err != nil {
+    t.Fatal(err)
+  }
+  if p, _ := game.Cell(1, 1); p != O {
+    t.Fatalf("b2 placed %s at 1 1, want O", p)
+  }
+  if err, _ := MakeMoveCoord(game, userB, "B"); err == nil {
+    t.Fatal("malformed coordinate accepted")
+  }
+  if err, _ := MakeMoveCoord(game, userB, "D1"); !errors.Is(err,
+      ErrOutOfRange) {
+    t.Fatalf("D1: got %v, want ErrOutOfRange", err)
+  }
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 1}, [2]int{2, 2}, [2]int{0, 2},
+    [2]int{2, 0}, [2]int{1, 0}, [2]int{2, 1})
+
+  exported := game.ExportMoves()
+  if want := "O:a1 X:b2 O:c3 X:c1 O:a3 X:a2 O:b3"; exported != want {
+    t.Fatalf("ExportMoves = %q, want %q", exported, want)
+  }
+  userA, userB := testUsers(t)
+  imported, err := ImportMoves(userA, userB, exported)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(imported.board, game.board) {
+    t.Fatalf("imported board\n%s\nwant\n%s", imported.board, game.board)
+  }
+  if imported.Result() != OWin || imported.ExportMoves() != exported {
+    t.Fatalf("imported game %s with moves %q", imported.Result(),
+      imported.ExportMoves())
+  }
+}
+
+func TestExportImportSettings(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWinLength(userA, userB, 5, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  game.mode = Misere
+  playMoves(t, game, [2]int{2, 2}, [2]int{0, 0}, [2]int{4, 4})
+
+  exported := game.ExportMoves()
+  if want := "size=5 win=4 mode=misere O:c3 X:a1 O:e5"; exported != want {
+    t.Fatalf("ExportMoves = %q, want %q", exported, want)
+  }
+  imported, err := ImportMoves(userA, userB, exported)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if imported.size != 5 || imported.winLength != 4 ||
+      imported.mode != Misere {
+    t.Fatalf("imported a %dx%d %d game with win length %d", imported.size,
+      imported.size, imported.mode, imported.winLength)
+  }
+  if imported.ExportMoves() != exported {
+    t.Fatalf("re-exported %q, want %q", imported.ExportMoves(), exported)
+  }
+
+  for _, s := range []string{
+    "size=x O:a1",
+    "size=2",
+    "win=6 size=5",
+    "mode=reverse",
+    "colour=red",
+  } {
+    if _, err := ImportMoves(userA, userB, s); err == nil {
+      t.Errorf("ImportMoves(%q) succeeded", s)
+    }
+  }
+}
+
+func TestImportMovesFinishedGameIsReleased(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := ImportMoves(userA, userB, "O:a1 X:b1 O:a2 X:b2 O:a3")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if game.Result() != OWin {
+    t.Fatalf("result %s, want %s", game.Result(), OWin)
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("finished game kept in the current games")
+  }
+}
+
+func TestImportMovesInvalid(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, s := range []string{
+    "O:a1 Xb2",
+    "O:a1 Q:b2",
+    "O:a1 X:z9",
+    "O:a1 O:b2",
+    "O:a1 X:a1",
+  } {
+    if _, err := ImportMoves(userA, userB, s); err == nil {
+      t.Errorf("ImportMoves(%q) succeeded", s)
+    }
+  }
+  if game, err := ImportMoves(userA, userB, ""); err != nil ||
+      game.totalPieces != 0 {
+    t.Fatalf("ImportMoves of no moves = %v", err)
+  }
+}
+
+func TestMakeMoveIndex(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  if err, _ := game.MakeMoveIndex(userA, 4); err != nil {
+    t.Fatal(err)
+  }
+  if game.board[1][1] != O {
+    t.Fatalf("index 4 did not map to the center:\n%s", game.board)
+  }
+  if err, _ := game.MakeMoveIndex(userB, 5); err != nil {
+    t.Fatal(err)
+  }
+  if game.board[1][2] != X {
+    t.Fatalf("index 5 did not map to 1 2:\n%s", game.board)
+  }
+
+  for _, idx := range []int{-1, -3, 9, 12} {
+    if err, _ := game.MakeMoveIndex(userA, idx); !errors.Is(err,
+        ErrOutOfRange) {
+      t.Errorf("index %d: got %v, want %v", idx, err, ErrOutOfRange)
+    }
+  }
+}
+
+func TestMakeMoveIndexFollowsSize(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWithSize(userA, userB, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err, _ := game.MakeMoveIndex(userA, 15); err != nil {
+    t.Fatal(err)
+  }
+  if game.board[3][3] != O {
+    t.Fatalf("index 15 did not map to the last cell:\n%s", game.board)
+  }
+}
@@ -0,0 +1,80 @@
+// Comparison of tictactoe game snapshots, e.g. to debug client desyncs.
+package tictactoe
+
+import (
+  "fmt"
+)
+
+/**
+ * Describes how the states of games a and b differ, one difference per
+ * string: their players, board cells, turn, piece counts, and result.
+ * Boards of different sizes are only reported as such. Returns an empty
+ * slice if the states are the same.
+ */
+func Diff(a *GameState, b *GameState) []string {
+  // Compare snapshots so that only one game is locked at a time.
+  a, b = a.Clone(), b.Clone()
+
+  diffs := []string{}
+  if a.size != b.size {
+    return append(diffs, fmt.Sprintf("size: %d != %d", a.size, b.size))
+  }
+  if len(a.players) != len(b.players) {
+    return append(diffs, fmt.Sprintf("players: %d != %d", len(a.players),
+      len(b.players)))
+  }
+
+  for i := range a.players {
+    if a.players[i] != b.players[i] {
+      diffs = append(diffs, fmt.Sprintf("player %s: %s != %s", Piece(i),
+        a.players[i], b.players[i]))
+    }
+  }
+  for i := 0; i < a.size; i++ {
+    for j := 0; j < a.size; j++ {
+      if a.board[i][j] != b.board[i][j] {
+        diffs = append(diffs, fmt.Sprintf("cell %d %d: %s != %s", i, j,
+          a.board[i][j], b.board[i][j]))
+      }
+    }
+  }
+  if a.currPiece != b.currPiece {
+    diffs = append(diffs, fmt.Sprintf("turn: %s != %s", a.currPiece,
+      b.currPiece))
+  }
+  for p := range a.counts {
+    diffs = append(diffs, diffCounts(Piece(p), a.counts[p], b.counts[p])...)
+  }
+  if a.totalPieces != b.totalPieces {
+    diffs = append(diffs, fmt.Sprintf("total pieces: %d != %d",
+      a.totalPieces, b.totalPieces))
+  }
+  if a.result != b.result {
+    diffs = append(diffs, fmt.Sprintf("result: %s != %s", a.result,
+      b.result))
+  }
+  return diffs
+}
+
+// Describes how the counts of the player holding piece p differ between
+// two same size games.
+func diffCounts(p Piece, a PlayerCounts, b PlayerCounts) []string {
+  diffs := []string{}
+  for i := range a.rows {
+    if a.rows[i] != b.rows[i] {
+      diffs = append(diffs, fmt.Sprintf("%s row %d count: %d != %d", p, i,
+        a.rows[i], b.rows[i]))
+    }
+    if a.cols[i] != b.cols[i] {
+      diffs = append(diffs, fmt.Sprintf("%s col %d count: %d != %d", p, i,
+        a.cols[i], b.cols[i]))
+    }
+  }
+  for i := range a.diags {
+    if a.diags[i] != b.diags[i] {
+      diffs = append(diffs, fmt.Sprintf("%s diag %d count: %d != %d", p, i,
+        a.diags[i], b.diags[i]))
+    }
+  }
+  return diffs
+}
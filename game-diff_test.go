@@ -0,0 +1,49 @@
+package tictactoe
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestDiffIdentical(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 2})
+  if diffs := Diff(game, game.Clone()); len(diffs) != 0 {
+    t.Fatalf("identical states differ: %v", diffs)
+  }
+}
+
+func TestDiffOneCell(t *testing.T) {
+  a := startTestGame(t)
+  playMoves(t, a, [2]int{1, 1})
+  b := a.Clone()
+  playMoves(t, b, [2]int{0, 0})
+
+  want := []string{
+    "cell 0 0: B != X",
+    "turn: X != O",
+    "X row 0 count: 0 != 1",
+    "X col 0 count: 0 != 1",
+    "X diag 0 count: 0 != 1",
+    "total pieces: 1 != 2",
+  }
+  if diffs := Diff(a, b); !reflect.DeepEqual(diffs, want) {
+    t.Fatalf("Diff() = %q, want %q", diffs, want)
+  }
+}
+
+func TestDiffSizes(t *testing.T) {
+  userA, userB := testUsers(t)
+  a, err := newGame(userA, userB, 3)
+  if err != nil {
+    t.Fatal(err)
+  }
+  b, err := newGame(userA, userB, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := []string{"size: 3 != 4"}
+  if diffs := Diff(a, b); !reflect.DeepEqual(diffs, want) {
+    t.Fatalf("Diff() = %q, want %q", diffs, want)
+  }
+}
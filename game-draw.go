@@ -0,0 +1,69 @@
+// Draws agreed between the players of tictactoe games.
+package tictactoe
+
+import (
+  "fmt"
+)
+
+// Checks if user is one of the game's players.
+func isPlayer(game *GameState, user string) bool {
+  for _, player := range game.players {
+    if player == user {
+      return true
+    }
+  }
+  return false
+}
+
+/**
+ * Offers the other players a draw on behalf of user, replacing any earlier 
+ * offer. The offer stands until accepted or until user makes a move. 
+ * Returns an error if the game is over or user is not one of the players.
+ */
+func (g *GameState) OfferDraw(user string) error {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if g.result != Pending {
+    return fmt.Errorf("game result %s: %w", g.result, ErrGameOver)
+  }
+  if !isPlayer(g, user) {
+    return fmt.Errorf("Player %s is not in the game.", user)
+  }
+  g.drawOffer = user
+  return nil
+}
+
+/**
+ * Accepts the standing draw offer on behalf of user, ending the game in a 
+ * Tie. The tie is recorded in user statistics, and the game is released 
+ * from currentGames like one ended by a move. Returns an error if the game 
+ * is over, user is not one of the players, or there is no offer from 
+ * another player to accept.
+ */
+func (g *GameState) AcceptDraw(user string) (GameResult, error) {
+  unlock := lockPair(g.key)
+  defer unlock()
+  g.mu.Lock()
+
+  switch {
+  case g.result != Pending:
+    defer g.mu.Unlock()
+    return g.result, fmt.Errorf("game result %s: %w", g.result, ErrGameOver)
+  case !isPlayer(g, user):
+    defer g.mu.Unlock()
+    return g.result, fmt.Errorf("Player %s is not in the game.", user)
+  case g.drawOffer == "" || g.drawOffer == user:
+    defer g.mu.Unlock()
+    return g.result, fmt.Errorf("No draw offer for %s to accept.", user)
+  }
+
+  g.result = Tie
+  g.drawOffer = ""
+  recordStats(g)
+  closeSubscribers(g)
+  g.mu.Unlock()
+
+  releaseGame(g)
+  return Tie, nil
+}
@@ -0,0 +1,73 @@
+package tictactoe
+
+import (
+  "errors"
+  "testing"
+)
+
+func TestAcceptDrawTies(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  if err := game.OfferDraw(userA); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := game.AcceptDraw(userA); err == nil {
+    t.Fatal("player accepted their own draw offer")
+  }
+  result, err := game.AcceptDraw(userB)
+  if err != nil || result != Tie {
+    t.Fatalf("AcceptDraw = %s, %v, want %s", result, err, Tie)
+  }
+  if game.Result() != Tie {
+    t.Fatalf("result %s after the draw, want %s", game.Result(), Tie)
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("drawn game is still stored")
+  }
+  if stats := GetStats(userA); stats != (Stats{Ties: 1}) {
+    t.Fatalf("stats %+v after the draw, want one tie", stats)
+  }
+  if err := game.OfferDraw(userB); !errors.Is(err, ErrGameOver) {
+    t.Fatalf("offer after the draw = %v, want %v", err, ErrGameOver)
+  }
+}
+
+func TestDrawOfferCancelledByMove(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  if err := game.OfferDraw(userA); err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{1, 1})
+  if _, err := game.AcceptDraw(userB); err == nil {
+    t.Fatal("accepted an offer withdrawn by a move")
+  }
+  if game.Result() != Pending {
+    t.Fatalf("result %s, want %s", game.Result(), Pending)
+  }
+
+  // Moves by the other player leave the offer standing.
+  if err := game.OfferDraw(userA); err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 0})
+  if result, err := game.AcceptDraw(userB); err != nil || result != Tie {
+    t.Fatalf("AcceptDraw = %s, %v, want %s", result, err, Tie)
+  }
+}
+
+func TestDrawByNonPlayer(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  if err := game.OfferDraw(userA + "/other"); err == nil {
+    t.Fatal("non-player offered a draw")
+  }
+  if err := game.OfferDraw(userA); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := game.AcceptDraw(userA + "/other"); err == nil {
+    t.Fatal("non-player accepted a draw")
+  }
+}
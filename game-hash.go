@@ -0,0 +1,97 @@
+// Zobrist hashing of tictactoe boards.
+package tictactoe
+
+import (
+  "math/rand"
+  "sync"
+)
+
+/**
+ * Zobrist tables keyed by board size. Each table holds a fixed random 
+ * constant for every (cell, piece) pair, indexed by row-major cell index 
+ * and then by player piece.
+ */
+var zobristTables = map[int][][maxPlayers]uint64{}
+
+// Guards all reads and writes of zobristTables.
+var zobristTablesMu sync.Mutex
+
+/**
+ * Gets the Zobrist table for size * size boards, creating it the first time 
+ * it is needed. The constants are generated from a seed derived from size, 
+ * so hashes are the same across runs.
+ */
+func zobristTable(size int) [][maxPlayers]uint64 {
+  zobristTablesMu.Lock()
+  defer zobristTablesMu.Unlock()
+
+  table, ok := zobristTables[size]
+  if !ok {
+    rng := rand.New(rand.NewSource(int64(size)))
+    table = make([][maxPlayers]uint64, size * size)
+    for i := range table {
+      table[i][O], table[i][X] = rng.Uint64(), rng.Uint64()
+    }
+    // T constants are drawn after all O and X ones, so that boards without 
+    // T pieces hash the same as before it was added.
+    for i := range table {
+      table[i][T] = rng.Uint64()
+    }
+    zobristTables[size] = table
+  }
+  return table
+}
+
+/**
+ * Counts the game's current board as having occurred once more, for 
+ * IsRepetition.
+ */
+func recordPosition(game *GameState) {
+  if game.positions == nil {
+    game.positions = map[uint64]int{}
+  }
+  game.positions[game.board.Hash()]++
+}
+
+func clonePositions(positions map[uint64]int) map[uint64]int {
+  if positions == nil {
+    return nil
+  }
+  c := make(map[uint64]int, len(positions))
+  for h, n := range positions {
+    c[h] = n
+  }
+  return c
+}
+
+/**
+ * Checks if the current board has occurred at least times times during 
+ * the game, counting the board it started from and every move since, 
+ * as groundwork for variants where repeating a position draws. Boards are 
+ * told apart by their Hash. Games decoded from JSON only count the board 
+ * they were saved with.
+ */
+func (g *GameState) IsRepetition(times int) bool {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return g.positions[g.board.Hash()] >= times
+}
+
+/**
+ * Gets a hash of the board for use as a map key, e.g. in a transposition 
+ * table. The hash is the XOR of the Zobrist constants of every piece on 
+ * the board, so equal boards hash equally and distinct boards rarely 
+ * collide.
+ */
+func (b Board) Hash() uint64 {
+  table := zobristTable(len(b))
+  var h uint64
+  for i := range b {
+    for j, p := range b[i] {
+      if p >= 0 && p < B {
+        h ^= table[i * len(b) + j][p]
+      }
+    }
+  }
+  return h
+}
@@ -0,0 +1,80 @@
+package tictactoe
+
+import (
+  "testing"
+)
+
+func TestHashIsStable(t *testing.T) {
+  board := Board{{O, B, X}, {B, O, B}, {X, B, B}}
+  h := board.Hash()
+  if h == 0 {
+    t.Fatal("non-empty board hashed to 0")
+  }
+  if again := board.Hash(); again != h {
+    t.Fatalf("hash changed from %x to %x", h, again)
+  }
+  if copied := board.clone().Hash(); copied != h {
+    t.Fatalf("equal board hashed to %x, want %x", copied, h)
+  }
+}
+
+func TestHashDistinguishesBoards(t *testing.T) {
+  // Every 3x3 board of O, X, and blank cells, reachable or not.
+  seen := map[uint64]int{}
+  for n := 0; n < 19683; n++ {
+    board := newBoard(3)
+    for i, c := 0, n; i < 9; i, c = i + 1, c / 3 {
+      board[i / 3][i % 3] = []Piece{B, O, X}[c % 3]
+    }
+    h := board.Hash()
+    if other, ok := seen[h]; ok {
+      t.Fatalf("boards %d and %d both hash to %x", other, n, h)
+    }
+    seen[h] = n
+  }
+}
+
+func TestHashDependsOnPiece(t *testing.T) {
+  o := Board{{O, B, B}, {B, B, B}, {B, B, B}}
+  x := Board{{X, B, B}, {B, B, B}, {B, B, B}}
+  if o.Hash() == x.Hash() {
+    t.Fatal("O and X in the same cell hash equally")
+  }
+}
+
+func TestIsRepetitionAtThreshold(t *testing.T) {
+  game := startTestGame(t)
+  if !game.IsRepetition(1) || game.IsRepetition(2) {
+    t.Fatal("starting board should have occurred exactly once")
+  }
+
+  // Taking the piece back off, as variants that remove pieces would, 
+  // returns to the empty board.
+  for i := 2; i <= 3; i++ {
+    playMoves(t, game, [2]int{1, 1})
+    if !game.IsRepetition(i - 1) || game.IsRepetition(i) {
+      t.Fatalf("round %d: board with one piece not seen exactly %d times",
+        i, i - 1)
+    }
+    game.mu.Lock()
+    removePiece(game, 1, 1)
+    game.currPiece = O
+    recordPosition(game)
+    game.mu.Unlock()
+    if !game.IsRepetition(i) || game.IsRepetition(i + 1) {
+      t.Fatalf("round %d: empty board not seen exactly %d times", i, i)
+    }
+  }
+}
+
+func TestUndoForgetsPosition(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{1, 1})
+  if game.IsRepetition(2) {
+    t.Fatal("replaying an undone move counted as a repetition")
+  }
+}
@@ -0,0 +1,335 @@
+// JSON serialization of tictactoe game state.
+package tictactoe
+
+import (
+  "encoding/json"
+  "fmt"
+  "time"
+)
+
+/**
+ * Serialized form of PlayerCounts. The fields of PlayerCounts are
+ * unexported, so they are mirrored here for encoding/json.
+ */
+type playerCountsJSON struct {
+  Rows []int `json:"rows"`
+  Cols []int `json:"cols"`
+  Diags [2]int `json:"diags"`
+}
+
+/**
+ * Serialized form of GameState. The board is stored as a 2D array of
+ * strings, "O", "X", "T", and "B" by default, so that saved games stay 
+ * human readable.
+ */
+type gameStateJSON struct {
+  Board [][]string `json:"board"`
+  CurrPiece string `json:"currPiece"`
+  // Usernames and piece counts of the players, in turn order.
+  Players []string `json:"players"`
+  Counts []playerCountsJSON `json:"counts"`
+  // Two-player fields of games saved before Players and Counts, only read.
+  CurrPlayer string `json:"currPlayer,omitempty"`
+  NextPlayer string `json:"nextPlayer,omitempty"`
+  OCounts *playerCountsJSON `json:"oCounts,omitempty"`
+  XCounts *playerCountsJSON `json:"xCounts,omitempty"`
+  TotalPieces int `json:"totalPieces"`
+  History []moveJSON `json:"history"`
+  Result string `json:"result"`
+  EndedByMove bool `json:"endedByMove,omitempty"`
+  Mode GameMode `json:"mode"`
+  WinningLine [][2]int `json:"winningLine,omitempty"`
+  WinLength int `json:"winLength"`
+  WinLines int `json:"winLines,omitempty"`
+  Paused bool `json:"paused,omitempty"`
+  // Time left on each player's clock in nanoseconds, keyed by piece.
+  Remaining map[string]time.Duration `json:"remaining,omitempty"`
+  Meta map[string]string `json:"meta,omitempty"`
+}
+
+// Serialized form of Move, with the piece stored as a string.
+type moveJSON struct {
+  Piece string `json:"piece"`
+  X int `json:"x"`
+  Y int `json:"y"`
+  Forced bool `json:"forced,omitempty"`
+}
+
+/**
+ * Maps pieces to and from the strings used for them in saved games, e.g. 
+ * for interop with systems that write blanks as spaces. DecodePiece must 
+ * invert EncodePiece.
+ */
+type PieceCodec interface {
+  EncodePiece(p Piece) string
+  DecodePiece(s string) (Piece, error)
+}
+
+// A PieceCodec writing each piece as the matching string, which must all 
+// be distinct.
+type StringCodec struct {
+  O, X, T, B string
+}
+
+// The codec used for saved games unless another is given, writing pieces 
+// as "O", "X", "T", and "B".
+var DefaultPieceCodec = StringCodec{O: "O", X: "X", T: "T", B: "B"}
+
+// The codec used by MarshalJSON and UnmarshalJSON. It should only be set 
+// before any games are serialized.
+var JSONPieceCodec PieceCodec = DefaultPieceCodec
+
+// Encodes p as its string, with unknown pieces written as blanks.
+func (c StringCodec) EncodePiece(p Piece) string {
+  switch p {
+  case O:
+    return c.O
+  case X:
+    return c.X
+  case T:
+    return c.T
+  }
+  return c.B
+}
+
+// Decodes s back into the piece whose string it is.
+func (c StringCodec) DecodePiece(s string) (Piece, error) {
+  switch s {
+  case c.O:
+    return O, nil
+  case c.X:
+    return X, nil
+  case c.T:
+    return T, nil
+  case c.B:
+    return B, nil
+  }
+  return B, fmt.Errorf("Unknown piece %q.", s)
+}
+
+func stringToResult(s string) (GameResult, error) {
+  // Games saved before results were tracked have no result and are ongoing.
+  if s == "" {
+    return Pending, nil
+  }
+  for _, r := range []GameResult{OWin, XWin, Tie, Pending, TWin} {
+    if s == r.String() {
+      return r, nil
+    }
+  }
+  return Pending, fmt.Errorf("Unknown game result %q.", s)
+}
+
+func (c PlayerCounts) toJSON() playerCountsJSON {
+  return playerCountsJSON{Rows: c.rows, Cols: c.cols, Diags: c.diags}
+}
+
+func (g *GameState) MarshalJSON() ([]byte, error) {
+  return MarshalGame(g, JSONPieceCodec)
+}
+
+func (g *GameState) UnmarshalJSON(data []byte) error {
+  return unmarshalGame(g, data, JSONPieceCodec)
+}
+
+// Serializes the game to JSON like MarshalJSON, writing pieces with codec.
+func MarshalGame(g *GameState, codec PieceCodec) ([]byte, error) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  board := make([][]string, g.size)
+  for i := 0; i < g.size; i++ {
+    board[i] = make([]string, g.size)
+    for j := 0; j < g.size; j++ {
+      board[i][j] = codec.EncodePiece(g.board[i][j])
+    }
+  }
+
+  history := make([]moveJSON, len(g.history))
+  for i, m := range g.history {
+    history[i] = moveJSON{Piece: codec.EncodePiece(m.Piece), X: m.X, Y: m.Y,
+      Forced: m.Forced}
+  }
+
+  var remaining map[string]time.Duration
+  if g.remaining != nil {
+    remaining = map[string]time.Duration{}
+    for p, d := range g.remaining {
+      remaining[codec.EncodePiece(p)] = d
+    }
+  }
+
+  counts := make([]playerCountsJSON, len(g.counts))
+  for i, c := range g.counts {
+    counts[i] = c.toJSON()
+  }
+
+  return json.Marshal(gameStateJSON{
+    Board: board,
+    CurrPiece: codec.EncodePiece(g.currPiece),
+    Players: g.players,
+    Counts: counts,
+    TotalPieces: g.totalPieces,
+    History: history,
+    Result: g.result.String(),
+    EndedByMove: g.endedByMove,
+    Mode: g.mode,
+    WinningLine: g.winningLine,
+    WinLength: g.winLength,
+    WinLines: g.winLines,
+    Paused: g.paused,
+    Remaining: remaining,
+    Meta: g.meta,
+  })
+}
+
+// Decodes a game serialized by MarshalGame with the same codec.
+func UnmarshalGame(data []byte, codec PieceCodec) (*GameState, error) {
+  g := &GameState{}
+  if err := unmarshalGame(g, data, codec); err != nil {
+    return nil, err
+  }
+  return g, nil
+}
+
+func unmarshalGame(g *GameState, data []byte, codec PieceCodec) error {
+  var s gameStateJSON
+  if err := json.Unmarshal(data, &s); err != nil {
+    return err
+  }
+
+  // The board size is given by the number of rows, and the board must be
+  // square with counts to match.
+  size := len(s.Board)
+  board := newBoard(size)
+  for i := 0; i < size; i++ {
+    if len(s.Board[i]) != size {
+      return fmt.Errorf("board row %d has %d cells, expected %d: %w",
+        i, len(s.Board[i]), size, ErrSizeMismatch)
+    }
+    for j := 0; j < size; j++ {
+      piece, err := codec.DecodePiece(s.Board[i][j])
+      if err != nil {
+        return err
+      }
+      board[i][j] = piece
+    }
+  }
+
+  currPiece, err := codec.DecodePiece(s.CurrPiece)
+  if err != nil {
+    return err
+  }
+
+  players, countsJSON := s.Players, s.Counts
+  if players == nil && s.OCounts != nil && s.XCounts != nil {
+    // Older saves only name the current and next player of a two-player 
+    // game, so their order follows from whose turn it is.
+    players = []string{s.CurrPlayer, s.NextPlayer}
+    if currPiece == X {
+      players = []string{s.NextPlayer, s.CurrPlayer}
+    }
+    countsJSON = []playerCountsJSON{*s.OCounts, *s.XCounts}
+  }
+  if len(players) < 2 || len(players) > maxPlayers ||
+      len(countsJSON) != len(players) {
+    return fmt.Errorf("Game must have between 2 and %d players with " +
+      "piece counts for each.", maxPlayers)
+  }
+  if currPiece < 0 || int(currPiece) >= len(players) {
+    return fmt.Errorf("Piece %s is not played in this game.", currPiece)
+  }
+
+  // Like LoadGame, the piece counts are rebuilt by scanning the board 
+  // rather than trusted from the save, so that they always match it.
+  counted := &GameState{size: size, board: newBoard(size),
+    counts: make([]PlayerCounts, len(players))}
+  initBoard(counted.board)
+  for i := range counted.counts {
+    counted.counts[i] = newPlayerCounts(size)
+  }
+  for i := 0; i < size; i++ {
+    for j := 0; j < size; j++ {
+      p := board[i][j]
+      if p == B {
+        continue
+      }
+      if p < 0 || int(p) >= len(players) {
+        return fmt.Errorf("Board position %d %d has piece %s, which is " +
+          "not played in this game.", i, j, p)
+      }
+      placePiece(counted, p, i, j)
+    }
+  }
+
+  // Games saved before win lengths were configurable need full lines.
+  winLength := s.WinLength
+  if winLength == 0 {
+    winLength = size
+  }
+  if winLength < minBoardSize || winLength > size {
+    return fmt.Errorf("Win length %d must be between %d and the board " +
+      "size %d.", winLength, minBoardSize, size)
+  }
+
+  result, err := stringToResult(s.Result)
+  if err != nil {
+    return err
+  }
+
+  var remaining map[Piece]time.Duration
+  if s.Remaining != nil {
+    remaining = map[Piece]time.Duration{}
+    for name, d := range s.Remaining {
+      piece, err := codec.DecodePiece(name)
+      if err != nil {
+        return err
+      }
+      remaining[piece] = d
+    }
+  }
+
+  // Each move in the history must have left its piece on a distinct cell 
+  // of the board, or Undo would take back pieces that aren't there.
+  var history []Move
+  seen := map[[2]int]bool{}
+  for i, m := range s.History {
+    piece, err := codec.DecodePiece(m.Piece)
+    if err != nil {
+      return err
+    }
+    if m.X < 0 || m.X >= size || m.Y < 0 || m.Y >= size {
+      return fmt.Errorf("History move %d at %d %d is off the board.", i + 1,
+        m.X, m.Y)
+    }
+    if board[m.X][m.Y] != piece || seen[[2]int{m.X, m.Y}] {
+      return fmt.Errorf("History move %d of %s at %d %d does not match " +
+        "the board.", i + 1, piece, m.X, m.Y)
+    }
+    seen[[2]int{m.X, m.Y}] = true
+    history = append(history, Move{Piece: piece, X: m.X, Y: m.Y,
+      Forced: m.Forced})
+  }
+
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  g.size = size
+  g.key = getUsersKey(players)
+  g.board = board
+  g.players = players
+  g.currPiece = currPiece
+  g.counts = counted.counts
+  g.totalPieces = counted.totalPieces
+  g.history = history
+  g.result = result
+  g.endedByMove = s.EndedByMove
+  g.mode = s.Mode
+  g.winningLine = s.WinningLine
+  g.winLines = s.WinLines
+  g.paused = s.Paused
+  g.remaining = remaining
+  g.meta = s.Meta
+  g.positions = nil
+  g.winLength = winLength
+  recordPosition(g)
+  return nil
+}
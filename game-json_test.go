@@ -0,0 +1,234 @@
+package tictactoe
+
+import (
+  "encoding/json"
+  "reflect"
+  "testing"
+)
+
+func TestJSONKeepsWhetherMoveEndedGame(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  data, err := json.Marshal(game)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var loaded GameState
+  if err := json.Unmarshal(data, &loaded); err != nil {
+    t.Fatal(err)
+  }
+  if err := loaded.Undo(); err != nil {
+    t.Fatalf("Undo of a loaded game won by a move: %v", err)
+  }
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 2}, [2]int{2, 0})
+  data, err := json.Marshal(game)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var loaded GameState
+  if err := json.Unmarshal(data, &loaded); err != nil {
+    t.Fatal(err)
+  }
+  // Only the current position is known after loading, not how often the 
+  // earlier ones occurred.
+  want, got := game.Clone(), loaded.Clone()
+  want.positions, got.positions = nil, nil
+  if !reflect.DeepEqual(got, want) {
+    t.Fatalf("round trip changed the game:\n got %+v\nwant %+v", got, want)
+  }
+}
+
+func TestJSONBoardUsesPieceNames(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 1})
+  data, err := json.Marshal(game)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var s struct {
+    Board [][]string `json:"board"`
+  }
+  if err := json.Unmarshal(data, &s); err != nil {
+    t.Fatal(err)
+  }
+  want := [][]string{{"O", "B", "B"}, {"B", "X", "B"}, {"B", "B", "B"}}
+  if !reflect.DeepEqual(s.Board, want) {
+    t.Fatalf("board %v, want %v", s.Board, want)
+  }
+}
+
+func TestJSONKeepsHistory(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{2, 2})
+  data, err := json.Marshal(game)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var loaded GameState
+  if err := json.Unmarshal(data, &loaded); err != nil {
+    t.Fatal(err)
+  }
+  if got, want := loaded.History(), game.History(); !reflect.DeepEqual(got,
+      want) {
+    t.Fatalf("loaded history %v, want %v", got, want)
+  }
+}
+
+func TestJSONKeepsMeta(t *testing.T) {
+  game := startTestGame(t)
+  game.SetMeta("room", "12")
+  data, err := json.Marshal(game)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var loaded GameState
+  if err := json.Unmarshal(data, &loaded); err != nil {
+    t.Fatal(err)
+  }
+  if v, ok := loaded.GetMeta("room"); !ok || v != "12" {
+    t.Fatalf("loaded GetMeta(room) = %q, %t, want 12", v, ok)
+  }
+}
+
+func TestCustomPieceCodecRoundTrip(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 1})
+  codec := StringCodec{O: "o", X: "x", T: "t", B: " "}
+  data, err := MarshalGame(game, codec)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var s struct {
+    Board [][]string `json:"board"`
+    CurrPiece string `json:"currPiece"`
+  }
+  if err := json.Unmarshal(data, &s); err != nil {
+    t.Fatal(err)
+  }
+  want := [][]string{{"o", " ", " "}, {" ", "x", " "}, {" ", " ", " "}}
+  if !reflect.DeepEqual(s.Board, want) || s.CurrPiece != "o" {
+    t.Fatalf("board %q with %q to move, want %q with \"o\"", s.Board,
+      s.CurrPiece, want)
+  }
+
+  loaded, err := UnmarshalGame(data, codec)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if diffs := Diff(loaded, game); len(diffs) != 0 {
+    t.Fatalf("round trip changed the game: %v", diffs)
+  }
+  if _, err := UnmarshalGame(data, DefaultPieceCodec); err == nil {
+    t.Fatal("decoded spaces for blanks with the default codec")
+  }
+}
+
+func TestStringCodecUnknownPiece(t *testing.T) {
+  if _, err := DefaultPieceCodec.DecodePiece("?"); err == nil {
+    t.Fatal("decoded an unknown piece")
+  }
+  if s := DefaultPieceCodec.EncodePiece(Piece(9)); s != "B" {
+    t.Fatalf("unknown piece encoded as %q, want a blank", s)
+  }
+}
+
+// Marshals game, then applies edit to the decoded JSON object, as if the 
+// save had been tampered with.
+func editedJSON(t *testing.T, game *GameState,
+    edit func(s map[string]interface{})) []byte {
+  t.Helper()
+  data, err := json.Marshal(game)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var s map[string]interface{}
+  if err := json.Unmarshal(data, &s); err != nil {
+    t.Fatal(err)
+  }
+  edit(s)
+  if data, err = json.Marshal(s); err != nil {
+    t.Fatal(err)
+  }
+  return data
+}
+
+func TestJSONRebuildsCountsFromBoard(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{2, 2})
+  data := editedJSON(t, game, func(s map[string]interface{}) {
+    s["totalPieces"] = 0
+    for _, c := range s["counts"].([]interface{}) {
+      c.(map[string]interface{})["rows"] = []int{3, 3, 3}
+    }
+  })
+
+  var loaded GameState
+  if err := json.Unmarshal(data, &loaded); err != nil {
+    t.Fatal(err)
+  }
+  if loaded.totalPieces != 3 {
+    t.Fatalf("total pieces %d, want 3 from the board", loaded.totalPieces)
+  }
+  if !reflect.DeepEqual(loaded.counts, game.counts) {
+    t.Fatalf("counts %v, want %v from the board", loaded.counts, game.counts)
+  }
+}
+
+func TestJSONRejectsHistoryNotOnBoard(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0})
+  for _, c := range []struct {
+    name string
+    move map[string]interface{}
+  }{
+    {"off the board", map[string]interface{}{"piece": "X", "x": 7, "y": 0}},
+    {"on another piece", map[string]interface{}{"piece": "X", "x": 1,
+      "y": 1}},
+    {"on a blank", map[string]interface{}{"piece": "X", "x": 2, "y": 2}},
+    {"again", map[string]interface{}{"piece": "X", "x": 0, "y": 0}},
+  } {
+    data := editedJSON(t, game, func(s map[string]interface{}) {
+      s["history"] = append(s["history"].([]interface{}), c.move)
+    })
+    var loaded GameState
+    if err := json.Unmarshal(data, &loaded); err == nil {
+      t.Errorf("loaded a history move %s", c.name)
+    }
+  }
+}
+
+func TestJSONRejectsWinLength(t *testing.T) {
+  game := startTestGame(t)
+  for _, winLength := range []int{minBoardSize - 1, 4, -1} {
+    data := editedJSON(t, game, func(s map[string]interface{}) {
+      s["winLength"] = winLength
+    })
+    var loaded GameState
+    if err := json.Unmarshal(data, &loaded); err == nil {
+      t.Errorf("loaded win length %d on a 3x3 board", winLength)
+    }
+  }
+
+  // Games saved before win lengths existed need full lines.
+  data := editedJSON(t, game, func(s map[string]interface{}) {
+    delete(s, "winLength")
+  })
+  var loaded GameState
+  if err := json.Unmarshal(data, &loaded); err != nil {
+    t.Fatal(err)
+  }
+  if loaded.winLength != 3 {
+    t.Fatalf("win length %d without one saved, want 3", loaded.winLength)
+  }
+}
@@ -0,0 +1,288 @@
+// Reconstruction of tictactoe games from saved boards.
+package tictactoe
+
+import (
+  "fmt"
+)
+
+/**
+ * Creates a game between userA (playing O) and userB (playing X) from a 
+ * saved board, with the player holding piece turn to move next. The board 
+ * must pass Validate, and the piece counts are rebuilt by scanning it. 
+ * Since O always moves first, 
+ * the board must hold as many O pieces as X pieces if it is O's turn, and 
+ * one more O piece than X pieces if it is X's turn. Overrides the previous 
+ * game if one already exists. A board that is already won or tied is 
+ * released straight away like any finished game, so it is only kept in 
+ * the current games while SetRetainFinishedGames is on.
+ */
+func LoadGame(userA string, userB string, board Board,
+    turn Piece) (*GameState, error) {
+  if turn != O && turn != X {
+    return nil, fmt.Errorf("Turn must be O or X, got %s.", turn)
+  }
+
+  size := len(board)
+  game, err := newGame(userA, userB, size)
+  if err != nil {
+    return nil, err
+  }
+  game.currPiece = turn
+
+  if err := board.Validate(); err != nil {
+    return nil, err
+  }
+
+  numO, numX := 0, 0
+  for i := 0; i < size; i++ {
+    for j := 0; j < size; j++ {
+      switch board[i][j] {
+      case O:
+        numO++
+      case X:
+        numX++
+      default:
+        continue
+      }
+      placePiece(game, board[i][j], i, j)
+    }
+  }
+
+  if turn == O && numO != numX || turn == X && numO != numX + 1 {
+    return nil, fmt.Errorf("Board has %d O and %d X pieces, which is " +
+      "inconsistent with %s to move.", numO, numX, turn)
+  }
+
+  game.result = boardResult(game)
+  // The move that completed them is unknown, but the lines are still shown.
+  if lines := board.completedLines(); len(lines) > 0 {
+    game.winningLine = lines[0]
+    game.winLines = len(lines)
+  }
+
+  // The game starts from the board as given rather than an empty one.
+  game.positions = nil
+  recordPosition(game)
+
+  storeRebuiltGame(game)
+  return game, nil
+}
+
+/**
+ * Creates a game from a saved board like LoadGame, for callers expecting a 
+ * size * size board, e.g. when the board comes from decoded JSON. Returns 
+ * an error wrapping ErrSizeMismatch if the board has a different number of 
+ * rows or any row has a different number of cells.
+ */
+func LoadGameWithSize(userA string, userB string, board Board, turn Piece,
+    size int) (*GameState, error) {
+  if len(board) != size {
+    return nil, fmt.Errorf("board has %d rows, expected %d: %w", len(board),
+      size, ErrSizeMismatch)
+  }
+  for i := range board {
+    if len(board[i]) != size {
+      return nil, fmt.Errorf("board row %d has %d cells, expected %d: %w",
+        i, len(board[i]), size, ErrSizeMismatch)
+    }
+  }
+  return LoadGame(userA, userB, board, turn)
+}
+
+/**
+ * Gets the result of the game from its piece counts alone, for games whose 
+ * last move is unknown. A completed line decides the game for the player 
+ * who completed it, as in checkGameOver.
+ */
+func boardResult(game *GameState) GameResult {
+  for i := range game.players {
+    p := Piece(i)
+    counts := countsFor(game, p)
+    for i := 0; i < game.size; i++ {
+      if counts.rows[i] == game.size || counts.cols[i] == game.size {
+        return lineResult(game, p)
+      }
+    }
+    if counts.diags[0] == game.size || counts.diags[1] == game.size {
+      return lineResult(game, p)
+    }
+  }
+
+  if game.totalPieces == game.size * game.size {
+    return Tie
+  }
+  return Pending
+}
+
+/**
+ * Creates a game between userA (playing O) and userB (playing X) with the 
+ * preset pieces already on the board, e.g. to give a weaker player a head 
+ * start. Presets are not part of the move history. The player with fewer 
+ * pieces on the board moves first, with O moving first if both have the 
+ * same number. Returns an error if a preset is off the board or on an 
+ * occupied position, or if the presets already end the game. Overrides the 
+ * previous game if one already exists.
+ */
+func StartGameHandicap(userA string, userB string,
+    preset []Move) (*GameState, error) {
+  game, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    return nil, err
+  }
+
+  numO, numX := 0, 0
+  for _, m := range preset {
+    switch m.Piece {
+    case O:
+      numO++
+    case X:
+      numX++
+    default:
+      return nil, fmt.Errorf("Preset piece must be O or X, got %s.", m.Piece)
+    }
+    if !onBoard(game.size, m.X, m.Y) {
+      return nil, fmt.Errorf("board position %d %d: %w", m.X, m.Y,
+        ErrOutOfRange)
+    }
+    if game.board[m.X][m.Y] != B {
+      return nil, fmt.Errorf("board position %d %d: %w", m.X, m.Y,
+        ErrCellOccupied)
+    }
+
+    placePiece(game, m.Piece, m.X, m.Y)
+    if result := checkGameOver(game, m.X, m.Y); result != Pending {
+      return nil, fmt.Errorf("Preset pieces end the game with result %s.",
+        result)
+    }
+  }
+
+  if numX < numO {
+    game.currPiece = X
+  }
+
+  // The game starts from the board as given rather than an empty one.
+  game.positions = nil
+  recordPosition(game)
+
+  storeGame(game)
+  return game, nil
+}
+
+/**
+ * Checks that the board could have come about in a game played by the 
+ * normal rules with full length lines. Returns a descriptive error if the 
+ * board is not square, wrapping ErrSizeMismatch, or not at least 
+ * minBoardSize, holds unknown pieces, has 
+ * piece counts that O moving first could not produce, has lines completed 
+ * by both players, has a completed line that is not the last move's, or 
+ * has completed lines that do not all pass through one position.
+ */
+func (b Board) Validate() error {
+  size := len(b)
+  if size < minBoardSize {
+    return fmt.Errorf("Board size %d is less than %d.", size, minBoardSize)
+  }
+
+  numO, numX := 0, 0
+  for i := 0; i < size; i++ {
+    if len(b[i]) != size {
+      return fmt.Errorf("board row %d has %d cells, expected %d: %w",
+        i, len(b[i]), size, ErrSizeMismatch)
+    }
+    for j := 0; j < size; j++ {
+      switch b[i][j] {
+      case O:
+        numO++
+      case X:
+        numX++
+      case B:
+      default:
+        return fmt.Errorf("Board position %d %d has unknown piece %s.",
+          i, j, b[i][j])
+      }
+    }
+  }
+
+  // O moves first, so O has either as many pieces as X or one more.
+  if numO != numX && numO != numX + 1 {
+    return fmt.Errorf("Board has %d O and %d X pieces, but O moves first " +
+      "so must have the same number as X or one more.", numO, numX)
+  }
+
+  oWon, xWon := false, false
+  // Counts how many completed lines pass through each position, since the 
+  // last move must lie on all of them.
+  onLines := map[[2]int]int{}
+  lines := b.completedLines()
+  for _, line := range lines {
+    if b[line[0][0]][line[0][1]] == O {
+      oWon = true
+    } else {
+      xWon = true
+    }
+    for _, pos := range line {
+      onLines[pos]++
+    }
+  }
+  shared := len(lines) == 0
+  for _, n := range onLines {
+    if n == len(lines) {
+      shared = true
+    }
+  }
+
+  switch {
+  case oWon && xWon:
+    return fmt.Errorf("Board has lines completed by both O and X.")
+  case oWon && numO != numX + 1:
+    return fmt.Errorf("Board has a line completed by O, but X has moved " +
+      "since.")
+  case xWon && numO != numX:
+    return fmt.Errorf("Board has a line completed by X, but O has moved " +
+      "since.")
+  case !shared:
+    return fmt.Errorf("Board has %d completed lines that no single move " +
+      "could have completed.", len(lines))
+  }
+  return nil
+}
+
+// Gets the positions of every full row, column, and diagonal on the 
+// board, in boardLines order.
+func (b Board) completedLines() [][][2]int {
+  completed := [][][2]int{}
+  for _, line := range boardLines(len(b)) {
+    first := b[line[0][0]][line[0][1]]
+    full := first != B
+    for _, pos := range line[1:] {
+      if b[pos[0]][pos[1]] != first {
+        full = false
+        break
+      }
+    }
+    if full {
+      completed = append(completed, line)
+    }
+  }
+  return completed
+}
+
+// Gets the positions of every row, column, and diagonal on a size * size 
+// board.
+func boardLines(size int) [][][2]int {
+  lines := make([][][2]int, 0, 2 * size + 2)
+  mainDiag := make([][2]int, size)
+  antiDiag := make([][2]int, size)
+  for i := 0; i < size; i++ {
+    row := make([][2]int, size)
+    col := make([][2]int, size)
+    for j := 0; j < size; j++ {
+      row[j] = [2]int{i, j}
+      col[j] = [2]int{j, i}
+    }
+    lines = append(lines, row, col)
+    mainDiag[i] = [2]int{i, i}
+    antiDiag[i] = [2]int{i, size - 1 - i}
+  }
+  return append(lines, mainDiag, antiDiag)
+}
@@ -0,0 +1,228 @@
+package tictactoe
+
+import (
+  "errors"
+  "reflect"
+  "testing"
+)
+
+func TestLoadGameMidGame(t *testing.T) {
+  userA, userB := testUsers(t)
+  board := Board{{O, B, X}, {B, O, B}, {B, B, B}}
+  game, err := LoadGame(userA, userB, board, X)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if game.totalPieces != 3 {
+    t.Fatalf("total pieces %d, want 3", game.totalPieces)
+  }
+  if diags := game.counts[O].diags; diags != [2]int{2, 1} {
+    t.Fatalf("O diagonal counts %v, want [2 1]", diags)
+  }
+  if user, _ := game.CurrentPlayer(); user != userB {
+    t.Fatalf("%s to move, want %s", user, userB)
+  }
+  if result := playMoves(t, game, [2]int{2, 2}); result != Pending {
+    t.Fatalf("result %s after X blocked", result)
+  }
+  if result := playMoves(t, game, [2]int{1, 0}, [2]int{2, 1},
+      [2]int{2, 0}); result != OWin {
+    t.Fatalf("result %s, want O to win down the first column", result)
+  }
+}
+
+func TestLoadGameTooManyO(t *testing.T) {
+  userA, userB := testUsers(t)
+  board := Board{{O, O, B}, {B, O, B}, {B, X, B}}
+  for _, turn := range []Piece{O, X} {
+    if _, err := LoadGame(userA, userB, board, turn); err == nil {
+      t.Errorf("loaded a board with too many O pieces, %s to move", turn)
+    }
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("invalid board stored as a game")
+  }
+}
+
+func TestLoadGameFinishedBoardIsReleased(t *testing.T) {
+  userA, userB := testUsers(t)
+  board := Board{{O, O, O}, {X, X, B}, {B, B, B}}
+  game, err := LoadGame(userA, userB, board, X)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if game.Result() != OWin {
+    t.Fatalf("result %s, want %s", game.Result(), OWin)
+  }
+  want := [][2]int{{0, 0}, {0, 1}, {0, 2}}
+  if line := game.WinningLine(); !reflect.DeepEqual(line, want) {
+    t.Fatalf("winning line %v, want %v", line, want)
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("finished board kept in the current games")
+  }
+
+  SetRetainFinishedGames(true)
+  defer SetRetainFinishedGames(false)
+  if game, err = LoadGame(userA, userB, board, X); err != nil {
+    t.Fatal(err)
+  }
+  if got, ok := GetGame(userA, userB); !ok || got != game {
+    t.Fatal("finished board not retained")
+  }
+}
+
+func TestStartGameHandicap(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameHandicap(userA, userB, []Move{
+    {Piece: O, X: 1, Y: 1}, {Piece: O, X: 0, Y: 0}, {Piece: X, X: 2, Y: 2}})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if game.totalPieces != 3 || game.PieceCount(O) != 2 ||
+      game.PieceCount(X) != 1 {
+    t.Fatalf("%d pieces, %d O and %d X, want 3, 2 and 1", game.totalPieces,
+      game.PieceCount(O), game.PieceCount(X))
+  }
+  if diags := game.counts[O].diags; diags != [2]int{2, 1} {
+    t.Fatalf("O diagonal counts %v, want [2 1]", diags)
+  }
+  if user, piece := game.CurrentPlayer(); user != userB || piece != X {
+    t.Fatalf("%s to move as %s, want %s as %s", user, piece, userB, X)
+  }
+}
+
+func TestStartGameHandicapRejectsWin(t *testing.T) {
+  userA, userB := testUsers(t)
+  _, err := StartGameHandicap(userA, userB, []Move{
+    {Piece: O, X: 0, Y: 0}, {Piece: O, X: 0, Y: 1}, {Piece: O, X: 0, Y: 2}})
+  if err == nil {
+    t.Fatal("preset completing a row was accepted")
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("rejected handicap game was stored")
+  }
+}
+
+func TestStartGameHandicapRejectsBadPlacements(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, preset := range [][]Move{
+    {{Piece: O, X: 3, Y: 0}},
+    {{Piece: O, X: 1, Y: 1}, {Piece: X, X: 1, Y: 1}},
+    {{Piece: B, X: 0, Y: 0}},
+  } {
+    if _, err := StartGameHandicap(userA, userB, preset); err == nil {
+      t.Errorf("preset %v was accepted", preset)
+    }
+  }
+}
+
+func TestValidateDoubleWinner(t *testing.T) {
+  board := Board{{O, O, O}, {X, X, X}, {B, B, B}}
+  if err := board.Validate(); err == nil {
+    t.Fatal("board won by both players was valid")
+  }
+  userA, userB := testUsers(t)
+  if _, err := LoadGame(userA, userB, board, O); err == nil {
+    t.Fatal("LoadGame accepted a board won by both players")
+  }
+}
+
+func TestValidateDisjointLines(t *testing.T) {
+  // O holds both diagonals of a 4x4 board, which share no position, so no 
+  // one move could have completed them.
+  board := Board{
+    {O, X, X, O},
+    {X, O, O, X},
+    {X, O, O, X},
+    {O, X, B, O},
+  }
+  if err := board.Validate(); err == nil {
+    t.Fatal("board with disjoint completed lines was valid")
+  }
+  userA, userB := testUsers(t)
+  if _, err := LoadGame(userA, userB, board, X); err == nil {
+    t.Fatal("loaded a board with disjoint completed lines")
+  }
+
+  // Both diagonals of a 3x3 board meet in the center.
+  board = Board{{O, X, O}, {X, O, X}, {O, X, O}}
+  if err := board.Validate(); err != nil {
+    t.Fatal(err)
+  }
+}
+
+func TestValidateParity(t *testing.T) {
+  for _, board := range []Board{
+    {{X, B, B}, {B, B, B}, {B, B, B}},
+    {{O, O, B}, {B, B, B}, {B, B, B}},
+  } {
+    if err := board.Validate(); err == nil {
+      t.Errorf("board with bad piece counts was valid:\n%s", board)
+    }
+  }
+}
+
+func TestValidateMoveAfterWin(t *testing.T) {
+  // X moved after O completed the top row.
+  board := Board{{O, O, O}, {X, X, B}, {X, B, B}}
+  if err := board.Validate(); err == nil {
+    t.Fatal("board with a move after the win was valid")
+  }
+}
+
+func TestValidateAcceptsReachableBoards(t *testing.T) {
+  for _, board := range []Board{
+    {{B, B, B}, {B, B, B}, {B, B, B}},
+    {{O, B, B}, {B, X, B}, {B, B, O}},
+    {{O, O, O}, {X, X, B}, {B, B, B}},
+    {{O, O, X}, {O, X, B}, {X, B, B}},
+  } {
+    if err := board.Validate(); err != nil {
+      t.Errorf("reachable board rejected: %v\n%s", err, board)
+    }
+  }
+}
+
+func TestValidateShape(t *testing.T) {
+  for _, board := range []Board{
+    {{B, B}, {B, B}},
+    {{B, B, B}, {B, B}, {B, B, B}},
+  } {
+    if err := board.Validate(); err == nil {
+      t.Errorf("board %v was valid", board)
+    }
+  }
+  err := Board{{B, B, B}, {B, B}, {B, B, B}}.Validate()
+  if !errors.Is(err, ErrSizeMismatch) {
+    t.Fatalf("ragged board error %v, want %v", err, ErrSizeMismatch)
+  }
+}
+
+func TestLoadGameWithSizeMismatch(t *testing.T) {
+  userA, userB := testUsers(t)
+  board := newBoard(4)
+  initBoard(board)
+  if _, err := LoadGameWithSize(userA, userB, board, O, 3); !errors.Is(err,
+      ErrSizeMismatch) {
+    t.Fatalf("4x4 board as 3x3: got %v, want %v", err, ErrSizeMismatch)
+  }
+
+  ragged := Board{{B, B, B}, {B, B, B, B}, {B, B, B}}
+  if _, err := LoadGameWithSize(userA, userB, ragged, O, 3); !errors.Is(err,
+      ErrSizeMismatch) {
+    t.Fatalf("ragged board: got %v, want %v", err, ErrSizeMismatch)
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("mismatched board stored as a game")
+  }
+
+  game, err := LoadGameWithSize(userA, userB, board, O, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if game.Size() != 4 {
+    t.Fatalf("loaded game has size %d, want 4", game.Size())
+  }
+}
@@ -0,0 +1,136 @@
+// Text rendering of tictactoe boards and game state.
+package tictactoe
+
+import (
+  "fmt"
+  "strings"
+  "unicode/utf8"
+)
+
+func (p Piece) String() string {
+  switch p {
+  case O:
+    return "O"
+  case X:
+    return "X"
+  case T:
+    return "T"
+  case B:
+    return "B"
+  }
+  return fmt.Sprintf("Piece(%d)", int(p))
+}
+
+func (r GameResult) String() string {
+  switch r {
+  case OWin:
+    return "O wins"
+  case XWin:
+    return "X wins"
+  case Tie:
+    return "Tie"
+  case Pending:
+    return "Pending"
+  case TWin:
+    return "T wins"
+  }
+  return fmt.Sprintf("GameResult(%d)", int(r))
+}
+
+// Glyphs used to render each kind of piece on a board.
+type Theme struct {
+  O, X, T, Blank string
+}
+
+// The theme used by Board.String, with blanks shown as '.'.
+var DefaultTheme = Theme{O: "O", X: "X", T: "T", Blank: "."}
+
+func (t Theme) glyph(p Piece) string {
+  switch p {
+  case O:
+    return t.O
+  case X:
+    return t.X
+  case T:
+    return t.T
+  }
+  return t.Blank
+}
+
+func renderPiece(p Piece) string {
+  return DefaultTheme.glyph(p)
+}
+
+/**
+ * Renders the board as a text grid using the glyphs of theme, one row per 
+ * line, with rows separated by dashed lines. Cells are padded to the width 
+ * of the widest glyph, counted in runes.
+ */
+func (b Board) Render(theme Theme) string {
+  width := 0
+  for _, g := range []string{theme.O, theme.X, theme.T, theme.Blank} {
+    if n := utf8.RuneCountInString(g); n > width {
+      width = n
+    }
+  }
+  dashes := strings.Repeat("-", width + 2)
+
+  var sb strings.Builder
+  size := len(b)
+  for i := 0; i < size; i++ {
+    if i > 0 {
+      sb.WriteString(strings.Repeat(dashes + "+", size - 1))
+      sb.WriteString(dashes + "\n")
+    }
+    for j := 0; j < size; j++ {
+      if j > 0 {
+        sb.WriteString("|")
+      }
+      glyph := theme.glyph(b[i][j])
+      pad := strings.Repeat(" ", width - utf8.RuneCountInString(glyph))
+      sb.WriteString(" " + glyph + pad + " ")
+    }
+    sb.WriteString("\n")
+  }
+  return sb.String()
+}
+
+/**
+ * Renders the board as a text grid with DefaultTheme, e.g.
+ *
+ *  O | . | X
+ * ---+---+---
+ *  . | O | .
+ * ---+---+---
+ *  X | . | .
+ */
+func (b Board) String() string {
+  return b.Render(DefaultTheme)
+}
+
+// Renders the board followed by the player whose turn it is.
+func (g *GameState) String() string {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return fmt.Sprintf("%sTurn: %s (%s)\n", g.board.String(), currPlayer(g),
+    renderPiece(g.currPiece))
+}
+
+/**
+ * Renders the row, column, and diagonal piece counts of each player for 
+ * debugging, one line per player, e.g.
+ *
+ * O rows [1 0 0] cols [1 0 0] diags [1 0]
+ * X rows [0 1 0] cols [0 1 0] diags [1 1]
+ */
+func (g *GameState) DebugCounts() string {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  var sb strings.Builder
+  for p, c := range g.counts {
+    fmt.Fprintf(&sb, "%s rows %v cols %v diags %v\n", Piece(p), c.rows,
+      c.cols, c.diags)
+  }
+  return sb.String()
+}
@@ -0,0 +1,136 @@
+package tictactoe
+
+import (
+  "testing"
+)
+
+func TestBoardString(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 2}, [2]int{1, 1}, [2]int{2, 0})
+
+  want := " O | . | X \n" +
+    "---+---+---\n" +
+    " . | O | . \n" +
+    "---+---+---\n" +
+    " X | . | . \n"
+  if got := game.board.String(); got != want {
+    t.Fatalf("Board.String() =\n%q\nwant\n%q", got, want)
+  }
+}
+
+func TestGameStateString(t *testing.T) {
+  game := startTestGame(t)
+  userA, _ := testUsers(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 1})
+
+  want := " . | X | . \n" +
+    "---+---+---\n" +
+    " . | O | . \n" +
+    "---+---+---\n" +
+    " . | . | . \n" +
+    "Turn: " + userA + " (O)\n"
+  if got := game.String(); got != want {
+    t.Fatalf("String() =\n%q\nwant\n%q", got, want)
+  }
+}
+
+func TestBoardStringFollowsSize(t *testing.T) {
+  board := newBoard(4)
+  initBoard(board)
+  board[3][3] = X
+
+  want := " . | . | . | . \n" +
+    "---+---+---+---\n" +
+    " . | . | . | . \n" +
+    "---+---+---+---\n" +
+    " . | . | . | . \n" +
+    "---+---+---+---\n" +
+    " . | . | . | X \n"
+  if got := board.String(); got != want {
+    t.Fatalf("4x4 Board.String() =\n%q\nwant\n%q", got, want)
+  }
+}
+
+func TestGameResultString(t *testing.T) {
+  for _, c := range []struct {
+    r GameResult
+    want string
+  }{
+    {OWin, "O wins"},
+    {XWin, "X wins"},
+    {Tie, "Tie"},
+    {Pending, "Pending"},
+    {TWin, "T wins"},
+    {GameResult(42), "GameResult(42)"},
+  } {
+    if got := c.r.String(); got != c.want {
+      t.Errorf("GameResult(%d).String() = %q, want %q", int(c.r), got, c.want)
+    }
+  }
+}
+
+func TestPieceString(t *testing.T) {
+  for _, c := range []struct {
+    p Piece
+    want string
+  }{
+    {O, "O"},
+    {X, "X"},
+    {T, "T"},
+    {B, "B"},
+    {Piece(-1), "Piece(-1)"},
+  } {
+    if got := c.p.String(); got != c.want {
+      t.Errorf("Piece(%d).String() = %q, want %q", int(c.p), got, c.want)
+    }
+  }
+}
+
+func TestRenderEmojiTheme(t *testing.T) {
+  board := Board{{O, B, X}, {B, B, B}, {B, B, B}}
+  theme := Theme{O: "⭕", X: "❌", T: "🔺", Blank: "⬜"}
+  want := " ⭕ | ⬜ | ❌ \n" +
+    "---+---+---\n" +
+    " ⬜ | ⬜ | ⬜ \n" +
+    "---+---+---\n" +
+    " ⬜ | ⬜ | ⬜ \n"
+  if got := board.Render(theme); got != want {
+    t.Fatalf("Render() =\n%q\nwant\n%q", got, want)
+  }
+}
+
+func TestRenderPadsWideGlyphs(t *testing.T) {
+  board := Board{{O, B, B}, {B, X, B}, {B, B, B}}
+  theme := Theme{O: "oo", X: "x", T: "t", Blank: ""}
+  want := " oo |    |    \n" +
+    "----+----+----\n" +
+    "    | x  |    \n" +
+    "----+----+----\n" +
+    "    |    |    \n"
+  if got := board.Render(theme); got != want {
+    t.Fatalf("Render() =\n%q\nwant\n%q", got, want)
+  }
+}
+
+func TestRenderDefaultTheme(t *testing.T) {
+  board := Board{{O, B, X}, {B, O, B}, {X, B, B}}
+  if got, want := board.Render(DefaultTheme), board.String(); got != want {
+    t.Fatalf("Render(DefaultTheme) =\n%q\nwant String()\n%q", got, want)
+  }
+}
+
+func TestDebugCounts(t *testing.T) {
+  game := startTestGame(t)
+  want := "O rows [0 0 0] cols [0 0 0] diags [0 0]\n" +
+    "X rows [0 0 0] cols [0 0 0] diags [0 0]\n"
+  if got := game.DebugCounts(); got != want {
+    t.Fatalf("DebugCounts() on a fresh game =\n%s\nwant\n%s", got, want)
+  }
+
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 1}, [2]int{0, 2})
+  want = "O rows [2 0 0] cols [1 0 1] diags [1 1]\n" +
+    "X rows [0 1 0] cols [0 1 0] diags [1 1]\n"
+  if got := game.DebugCounts(); got != want {
+    t.Fatalf("DebugCounts() =\n%s\nwant\n%s", got, want)
+  }
+}
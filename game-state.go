@@ -1,36 +1,121 @@
 // Tictactoe game state.
+package tictactoe
+
 import (
-  fmt
+  "context"
+  "errors"
+  "fmt"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
 )
 
-// Board size - change this to change the size of the game board.
+// Default board size, used by games started without an explicit size.
 const boardSize = 3
 
+// Smallest supported board size. Boards are always square, so that every 
+// board has exactly two diagonals of full length.
+const minBoardSize = 3
+
+// Errors returned by makeMove, wrapped in a MoveError naming the offending 
+// player or position.
+var (
+  ErrNotYourTurn = errors.New("not your turn")
+  ErrOutOfRange = errors.New("out of range")
+  ErrCellOccupied = errors.New("cell is not empty")
+  ErrGameOver = errors.New("game is over")
+  ErrGamePaused = errors.New("game is paused")
+  ErrOutOfTime = errors.New("out of time")
+  ErrMalformedCoord = errors.New("malformed coordinate")
+  ErrUnknownPiece = errors.New("piece is not played in this game")
+)
+
+// Error returned when a board's dimensions don't match the size expected.
+var ErrSizeMismatch = errors.New("board size mismatch")
+
+// Machine readable codes of the errors returned by makeMove and the other 
+// ways of making a move, e.g. for JSON API responses.
+var moveErrorCodes = map[error]string{
+  ErrNotYourTurn: "not_your_turn",
+  ErrOutOfRange: "out_of_range",
+  ErrCellOccupied: "occupied",
+  ErrGameOver: "game_over",
+  ErrGamePaused: "game_paused",
+  ErrOutOfTime: "out_of_time",
+  ErrMalformedCoord: "malformed_coordinate",
+  ErrUnknownPiece: "unknown_piece",
+  context.Canceled: "cancelled",
+  context.DeadlineExceeded: "deadline_exceeded",
+}
+
+/**
+ * An error rejecting a move, with a machine readable Code such as 
+ * "not_your_turn" and a human readable Message. It unwraps to the matching 
+ * sentinel error, so errors.Is(err, ErrNotYourTurn) still holds.
+ */
+type MoveError struct {
+  Code string
+  Message string
+  err error
+}
+
+func (e *MoveError) Error() string {
+  return e.Message
+}
+
+func (e *MoveError) Unwrap() error {
+  return e.err
+}
+
+// Makes the MoveError for sentinel err, with the message prefixed by what 
+// the error is about, e.g. "player bob", unless about is empty.
+func newMoveError(err error, about string) *MoveError {
+  msg := err.Error()
+  if about != "" {
+    msg = about + ": " + msg
+  }
+  return &MoveError{Code: moveErrorCodes[err], Message: msg, err: err}
+}
+
 /**
  * Represents a piece on a game board.
  * O - player 1 piece
  * X - player 2 piece
+ * T - player 3 piece, only used in games with more than two players
  * B - blank placeholder piece
+ *
+ * Player pieces are numbered from 0 in turn order, so a player's piece 
+ * doubles as their index among the players of a game.
  */
 type Piece int
-const Piece {
-  O = iota
-  X = iota
-  B = iota
-}
+const (
+  O Piece = iota
+  X
+  T
+  B
+)
+
+// Most players a game can have, one per player piece.
+const maxPlayers = int(B)
 
-type Board [boardSize][boardSize]Piece
+/**
+ * A square game board indexed as board[x][y]. The board size is the
+ * number of rows, len(board), and every row has the same length.
+ */
+type Board [][]Piece
 
 /**
- * Counts of player pieces in each row, column, and diagonal boardSize 
- * length line. If a player ever contains boardSize number of pieces 
+ * Counts of player pieces in each row, column, and diagonal size 
+ * length line. If a player ever contains size number of pieces 
  * in a single line, the player wins the game.
  *
- * Each board has boardSize rows and columns, and only 2 diagonals.
+ * Each board has size rows and columns, and only 2 diagonals.
  */
 type PlayerCounts struct {
-  rows [boardSize]int
-  cols [boardSize]int
+  rows []int
+  cols []int
   diags [2]int
 }
 
@@ -40,122 +125,735 @@ type PlayerCounts struct {
  * - XWin - Player with piece X has won the game.
  * - Tie  - Board is filled, no winner.
  * - Pending - Board is not full and no winner, keep playing.
+ * - TWin - Player with piece T has won the game.
  */
 type GameResult int
-const GameResult {
-  OWin = iota
-  XWin = iota
-  Tie = iota
-  Pending = iota
+const (
+  OWin GameResult = iota
+  XWin
+  Tie
+  Pending
+  TWin
+)
+
+/**
+ * Gets a stable code for the result for use on the wire, which unlike the 
+ * GameResult values does not change if results are reordered: 0 for 
+ * Pending, 1 for OWin, 2 for XWin, 3 for Tie, and 4 for TWin. Unknown 
+ * results get -1.
+ */
+func (r GameResult) Code() int {
+  switch r {
+  case Pending:
+    return 0
+  case OWin:
+    return 1
+  case XWin:
+    return 2
+  case Tie:
+    return 3
+  case TWin:
+    return 4
+  }
+  return -1
 }
 
+// A single move in a game, placing Piece at board position (X,Y). Forced 
+// is set for pieces placed by ForceMove regardless of turn order.
+type Move struct {
+  Piece Piece
+  X, Y int
+  Forced bool
+}
+
+/**
+ * The rules variant of a game, one of:
+ * - Normal - Completing a line wins the game.
+ * - Misere - Completing a line loses the game.
+ */
+type GameMode int
+const (
+  Normal GameMode = iota
+  Misere
+)
+
 type GameState struct {
-  // The boardSize * boardSize game board, each cell containing a piece 
-  // (O, X, or B for blank).
-  board *Board
-  // The player who must make the next move, identified by their game piece
-  // (O or X).
+  // Key of the game in currentGames, from getUserPairKey.
+  key string
+  // Guards all fields below against concurrent moves on the same game.
+  mu sync.Mutex
+  // The number of rows and columns on the board.
+  size int
+  // The number of consecutive pieces in a row, column, or diagonal needed 
+  // to complete a line, at most size.
+  winLength int
+  // The size * size game board, each cell containing a piece 
+  // (O, X, T, or B for blank).
+  board Board
+  // Usernames of the players in turn order, indexed by their game piece.
+  players []string
+  // The player who must make the next move, identified by their game piece.
   currPiece Piece
-  currPlayer string
-  nextPlayer string
-  // Counts of number of pieces player O has in rows, cols, and diags.
-  oCounts PlayerCounts
-  // Counts of number of pieces player X has in rows, cols, and diags.
-  xCounts PlayerCounts
+  // Counts of number of pieces each player has in rows, cols, and diags, 
+  // indexed by their game piece.
+  counts []PlayerCounts
+  // Number of pieces placed on the board by all players.
   totalPieces int
+  // Moves played so far, in order, including pieces placed by ForceMove.
+  history []Move
+  // The result of the game, Pending until a player wins or the board fills.
+  result GameResult
+  // Whether the last move in history ended the game, rather than e.g. a 
+  // forfeit or an agreed draw.
+  endedByMove bool
+  // Whether the result has been recorded in user statistics. Copies made 
+  // by Clone are never counted.
+  counted bool
+  // Whether the game is a copy made by Clone, which shares the live game's 
+  // key and players but is never counted, released, or stored.
+  detached bool
+  // The rules variant being played.
+  mode GameMode
+  // Positions of the line completed by the move that won the game, if any.
+  winningLine [][2]int
+  // Number of lines completed at once by the move that won the game.
+  winLines int
+  // Whether moves are rejected until the game is resumed.
+  paused bool
+  // Time left on each player's clock, keyed by piece, or nil if the game 
+  // is untimed.
+  remaining map[Piece]time.Duration
+  // Extra ways to win checked after each move, beyond completing a line.
+  conditions []WinCondition
+  // Arbitrary data attached to the game by its users, e.g. a room id.
+  meta map[string]string
+  // Moves made by MakeMoveWithID, keyed by move ID.
+  moveIDs map[string]idMove
+  // Username of the player offering a draw, or empty if there is no offer.
+  drawOffer string
+  // Number of times each board has occurred in the game, keyed by its Hash.
+  positions map[uint64]int
+  // Functions to call after each successful move, in registration order.
+  callbacks []MoveCallback
+  // Subscribers sent each successful move, closed once the game is over.
+  subscribers []*subscriber
+}
+
+// A function called with the move made and the resulting game result after 
+// each successful move in a game.
+type MoveCallback func(g *GameState, m Move, result GameResult)
+
+/**
+ * A custom way to win checked after every move, e.g. taking all four 
+ * corners. It is given the board with last already placed, and reports the 
+ * winning piece with ok set if the move won the game. The board must not be 
+ * modified.
+ */
+type WinCondition func(b Board, last Move) (winner Piece, ok bool)
+
+/**
+ * Map of currently ongoing games, keyed by getUserPairKey(userA, userB).
+ */
+var currentGames = map[string]*GameState{}
+
+// Guards all reads and writes of currentGames.
+var currentGamesMu sync.RWMutex
+
+// Whether games stay in currentGames once they are over, guarded by 
+// currentGamesMu.
+var retainFinished bool
+
+/**
+ * Sets whether games stay in currentGames once they are over, until they 
+ * are replaced or cleared. By default, a game is removed as soon as a move 
+ * or forfeit ends it, so that finished games don't accumulate.
+ */
+func SetRetainFinishedGames(retain bool) {
+  currentGamesMu.Lock()
+  retainFinished = retain
+  currentGamesMu.Unlock()
+}
+
+/**
+ * Finished games released from currentGames, keyed like currentGames, so 
+ * that Rematch can still follow them. Each is kept until its players start 
+ * another game or are cleared, guarded by currentGamesMu.
+ */
+var lastGames = map[string]*GameState{}
+
+// Removes game from currentGames now that it is over, unless finished 
+// games are retained or it has already been replaced, keeping it in 
+// lastGames for a rematch.
+func releaseGame(game *GameState) {
+  if game.detached {
+    return
+  }
+  currentGamesMu.Lock()
+  if !retainFinished && currentGames[game.key] == game {
+    delete(currentGames, game.key)
+    lastGames[game.key] = game
+  }
+  currentGamesMu.Unlock()
 }
 
 /**
- * Map of currently ongoing games, keyed by 'userA$$userB', where userA is 
- * lexicographically smaller than userB.
+ * Locks serializing operations on the game between a user pair, keyed like 
+ * currentGames. Unlike GameState.mu, a pair's lock outlives any one game, 
+ * so e.g. clearing a game cannot interleave with a move still being made 
+ * on it. Operations on different pairs proceed in parallel. A pair's entry 
+ * is deleted once nothing holds or waits for its lock, so locks don't 
+ * accumulate for every pair that ever played.
  */
-currentGames map[string]*GameState
+var pairLocks = map[string]*pairLock{}
+
+// Guards all reads and writes of pairLocks, and the refs of every entry.
+var pairLocksMu sync.Mutex
+
+// A pair's lock, with the number of callers holding or waiting for it.
+type pairLock struct {
+  mu sync.Mutex
+  refs int
+}
+
+// Locks the user pair with the given key, returning the unlock function. 
+// The pair lock is not reentrant, so the holder must not lock it again.
+func lockPair(key string) func() {
+  pairLocksMu.Lock()
+  lock, ok := pairLocks[key]
+  if !ok {
+    lock = &pairLock{}
+    pairLocks[key] = lock
+  }
+  lock.refs++
+  pairLocksMu.Unlock()
+
+  lock.mu.Lock()
+  return func() {
+    lock.mu.Unlock()
+    pairLocksMu.Lock()
+    lock.refs--
+    if lock.refs == 0 {
+      delete(pairLocks, key)
+    }
+    pairLocksMu.Unlock()
+  }
+}
 
 /**
  * Gets the key for the user pair, where the key is one of:
- * - "userA$$userB" if userA <= userB
- * - "userB$$userA" if userA < userB.
+ * - "len(userA):userA|len(userB):userB" if userA <= userB
+ * - "len(userB):userB|len(userA):userA" if userB < userA.
  *
  * This ensures that we never have two concurrent games between 
- * the same pair of users.
+ * the same pair of users. Prefixing each username with its length 
+ * keeps keys distinct even if usernames contain the separators.
  */
 func getUserPairKey(userA string, userB string) string {
-  if userA <= userB {
-    return userA + "$$" + userB
+  return getUsersKey([]string{userA, userB})
+}
+
+// Gets the key for a group of users like getUserPairKey, joining every 
+// length-prefixed username in sorted order.
+func getUsersKey(users []string) string {
+  sorted := append([]string(nil), users...)
+  sort.Strings(sorted)
+  parts := make([]string, len(sorted))
+  for i, user := range sorted {
+    parts[i] = fmt.Sprintf("%d:%s", len(user), user)
+  }
+  return strings.Join(parts, "|")
+}
+
+/**
+ * Splits a key made by getUsersKey back into its usernames, in key order. 
+ * The last return value is false if the key is malformed.
+ */
+func parseUsersKey(key string) ([]string, bool) {
+  var users []string
+  for {
+    sep := strings.IndexByte(key, ':')
+    if sep < 0 {
+      return nil, false
+    }
+    n, err := strconv.Atoi(key[:sep])
+    if err != nil || n < 0 || sep + 1 + n > len(key) {
+      return nil, false
+    }
+    users = append(users, key[sep + 1:sep + 1 + n])
+    key = key[sep + 1 + n:]
+    if key == "" {
+      return users, true
+    }
+    if !strings.HasPrefix(key, "|") {
+      return nil, false
+    }
+    key = key[1:]
+  }
+}
+
+// Allocates a size * size board.
+func newBoard(size int) Board {
+  board := make(Board, size)
+  for i := range board {
+    board[i] = make([]Piece, size)
   }
-  return userB + "$$" + userA
+  return board
 }
 
-func initBoard(board *Board) {
+func initBoard(board Board) {
   // Fill the board with blanks.
-  for i := 0; i < boardSize; i++ {
-    for j := 0; j < boardSize; j++ {
+  for i := range board {
+    for j := range board[i] {
       board[i][j] = B
     }
   }
 }
 
-// Creates a new game between userA and userB. Overrides the previous game 
-// if one already exists.
-func startGame(userA string, userB string) *GameState {
-  var board Board
+func newPlayerCounts(size int) PlayerCounts {
+  return PlayerCounts{rows: make([]int, size), cols: make([]int, size)}
+}
+
+/**
+ * Creates a new game between userA (playing O and moving first) and userB 
+ * (playing X) on a size * size board, without storing it in currentGames. 
+ * Returns an error if either username is empty or they are the same, or if 
+ * size is less than minBoardSize.
+ */
+func newGame(userA string, userB string, size int) (*GameState, error) {
+  return newGameUsers([]string{userA, userB}, size)
+}
+
+/**
+ * Creates a new game like newGame between two or more users, who take 
+ * turns in the given order playing O, X, and T. Returns an error if there 
+ * are too few or too many users, or any username is empty or repeated.
+ */
+func newGameUsers(users []string, size int) (*GameState, error) {
+  if size < minBoardSize {
+    return nil, fmt.Errorf("Board size %d is less than %d.", size,
+      minBoardSize)
+  }
+  if err := checkUsers(users); err != nil {
+    return nil, err
+  }
+
+  board := newBoard(size)
   // Initialize board by filling with blanks.
-  initBoard(&board)
+  initBoard(board)
+
+  counts := make([]PlayerCounts, len(users))
+  for i := range counts {
+    counts[i] = newPlayerCounts(size)
+  }
+
+  game := &GameState{key: getUsersKey(users), size: size, winLength: size,
+    board: board, players: append([]string(nil), users...), currPiece: O,
+    counts: counts, result: Pending}
+  recordPosition(game)
+  return game, nil
+}
+
+// Stores the game in currentGames, overriding the previous game between 
+// its players if one already exists, and counts it in headToHead.
+func storeGame(game *GameState) {
+  currentGamesMu.Lock()
+  currentGames[game.key] = game
+  delete(lastGames, game.key)
+  currentGamesMu.Unlock()
+  recordHeadToHead(game)
+}
+
+// Stores a game rebuilt from a saved board or moves like storeGame, then 
+// releases it if it is already over, as if its last move had just been 
+// made.
+func storeRebuiltGame(game *GameState) {
+  storeGame(game)
+  if game.result != Pending {
+    releaseGame(game)
+  }
+}
+
+// Creates a new game between userA and userB on the default boardSize 
+// board. Overrides the previous game if one already exists.
+func startGame(userA string, userB string) (*GameState, error) {
+  return StartGameWithSize(userA, userB, boardSize)
+}
+
+// Creates a new game between userA and userB on a size * size board, where 
+// size is at least minBoardSize. Overrides the previous game if one already 
+// exists.
+func StartGameWithSize(userA string, userB string,
+    size int) (*GameState, error) {
+  game, err := newGame(userA, userB, size)
+  if err != nil {
+    return nil, err
+  }
+  storeGame(game)
+  return game, nil
+}
+
+/**
+ * Creates a new game between userA and userB on a size * size board, where 
+ * completing a line only needs winLength consecutive pieces rather than a 
+ * full row, column, or diagonal. winLength must be at least minBoardSize 
+ * and at most size. Overrides the previous game if one already exists.
+ */
+func StartGameWinLength(userA string, userB string, size int,
+    winLength int) (*GameState, error) {
+  if winLength < minBoardSize || winLength > size {
+    return nil, fmt.Errorf("Win length %d must be between %d and the " +
+      "board size %d.", winLength, minBoardSize, size)
+  }
+
+  game, err := newGame(userA, userB, size)
+  if err != nil {
+    return nil, err
+  }
+  game.winLength = winLength
+  storeGame(game)
+  return game, nil
+}
+
+/**
+ * Creates a new game between userA and userB on the default boardSize board 
+ * that can also be won by meeting any of conditions, checked in order after 
+ * completed lines. Conditions are not saved with the game as JSON. 
+ * Overrides the previous game if one already exists.
+ */
+func StartGameWithConditions(userA string, userB string,
+    conditions []WinCondition) (*GameState, error) {
+  game, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    return nil, err
+  }
+  game.conditions = append([]WinCondition(nil), conditions...)
+  storeGame(game)
+  return game, nil
+}
+
+/**
+ * Creates a new game between userA and userB where firstUser, who must be 
+ * one of the two, plays O and makes the first move. Overrides the previous 
+ * game if one already exists.
+ */
+func StartGameFirstPlayer(userA string, userB string,
+    firstUser string) (*GameState, error) {
+  switch firstUser {
+  case userA:
+    return startGame(userA, userB)
+  case userB:
+    return startGame(userB, userA)
+  }
+  return nil, fmt.Errorf("Player %s is not in the game.", firstUser)
+}
+
+// Creates a new game between userA and userB on the default boardSize 
+// board using the given rules variant. Overrides the previous game if one 
+// already exists.
+func StartGameMode(userA string, userB string,
+    mode GameMode) (*GameState, error) {
+  game, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    return nil, err
+  }
+  game.mode = mode
+  storeGame(game)
+  return game, nil
+}
+
+/**
+ * Creates a new game between userA and userB on the default boardSize board 
+ * like startGame, unless they already have a game in progress. Returns the 
+ * game and whether it was created, so the existing game and false if there 
+ * is one, or nil and false if the usernames are invalid. A finished game 
+ * still stored for the pair is replaced.
+ */
+func StartGameIfAbsent(userA string, userB string) (*GameState, bool) {
+  game, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    return nil, false
+  }
+
+  // Holding the pair lock keeps a move from finishing the existing game 
+  // while it is checked.
+  unlock := lockPair(game.key)
+  defer unlock()
+  if existing, ok := GetGame(userA, userB); ok &&
+      existing.Result() == Pending {
+    return existing, false
+  }
+  storeGame(game)
+  return game, true
+}
 
-  game := &GameState{board: &board, currPiece: O, currPlayer: userA}
+/**
+ * Starts a new game between userA and userB to follow their previous game, 
+ * keeping its board size, win length, rules variant, and win conditions. 
+ * The loser of the previous game moves first, or if it had no winner, the 
+ * player who moved second. The previous game is the one stored for the 
+ * users, or else the last one they finished, which is kept for a rematch 
+ * even once released from currentGames. Returns an error if the users have 
+ * no previous game.
+ */
+func Rematch(userA string, userB string) (*GameState, error) {
   key := getUserPairKey(userA, userB)
-  currentGames[key] = game
-  return game
+  currentGamesMu.RLock()
+  prev, ok := currentGames[key]
+  if !ok {
+    prev, ok = lastGames[key]
+  }
+  currentGamesMu.RUnlock()
+  if !ok {
+    return nil, fmt.Errorf("No previous game between %s and %s.", userA,
+      userB)
+  }
+
+  prev.mu.Lock()
+  oUser, xUser := pieceOwner(prev, O), pieceOwner(prev, X)
+  size, mode, result := prev.size, prev.mode, prev.result
+  winLength := prev.winLength
+  conditions := append([]WinCondition(nil), prev.conditions...)
+  prev.mu.Unlock()
+
+  first, second := xUser, oUser
+  if result == XWin {
+    first, second = oUser, xUser
+  }
+  game, err := newGame(first, second, size)
+  if err != nil {
+    return nil, err
+  }
+  game.winLength = winLength
+  game.mode = mode
+  game.conditions = conditions
+  storeGame(game)
+  return game, nil
+}
+
+// Checks that users can play a game together, returning an error for too 
+// few or too many users, or any empty or repeated username.
+func checkUsers(users []string) error {
+  if len(users) < 2 || len(users) > maxPlayers {
+    return fmt.Errorf("Games need between 2 and %d players, got %d.",
+      maxPlayers, len(users))
+  }
+  seen := map[string]bool{}
+  for _, user := range users {
+    if user == "" {
+      return fmt.Errorf("Usernames must not be empty.")
+    }
+    if seen[user] {
+      return fmt.Errorf("Player %s cannot play against themselves.", user)
+    }
+    seen[user] = true
+  }
+  return nil
+}
+
+/**
+ * Creates a new game between all of users, who take turns in the given 
+ * order playing O, X, and then T, on a size * size board. Up to maxPlayers 
+ * can play. Overrides the previous game between the same users if one 
+ * already exists.
+ */
+func StartMultiplayer(users []string, size int) (*GameState, error) {
+  game, err := newGameUsers(users, size)
+  if err != nil {
+    return nil, err
+  }
+  storeGame(game)
+  return game, nil
 }
 
-func clearGame(userA string, userB string) err {
+func clearGame(userA string, userB string) error {
   key := getUserPairKey(userA, userB)
+  unlock := lockPair(key)
+  defer unlock()
+  currentGamesMu.Lock()
   delete(currentGames, key)
+  delete(lastGames, key)
+  currentGamesMu.Unlock()
   return nil
 }
 
-func getDiag(x int, y int) int {
-  last := boardSize - 1
-  // Top left to bottom right diagonal.
-  if x == 0 && y == 0 || x == last && y == last {
-    return 0
+/**
+ * Clears every ongoing game user is playing, e.g. when they disconnect, and 
+ * returns the number of games cleared. Games that were not over are 
+ * forfeited by user, as with Forfeit, so they are not counted in user 
+ * statistics.
+ */
+func ClearGamesForUser(user string) int {
+  games := map[string]*GameState{}
+  currentGamesMu.Lock()
+  for key, game := range currentGames {
+    users, _ := parseUsersKey(key)
+    for _, u := range users {
+      if u == user {
+        games[key] = game
+      }
+    }
   }
-  // Top right to bottom left diagonal.
-  if x == last && y == 0 || x == 0 && y == last {
-    return 1
+  // Finished games kept for a rematch are simply forgotten.
+  for key := range lastGames {
+    users, _ := parseUsersKey(key)
+    for _, u := range users {
+      if u == user {
+        delete(lastGames, key)
+      }
+    }
   }
-  // Not a diagonal.
-  return -1
+  currentGamesMu.Unlock()
+
+  cleared := 0
+  for key, game := range games {
+    unlock := lockPair(key)
+    currentGamesMu.Lock()
+    // The game may have been replaced or cleared since it was found.
+    removed := currentGames[key] == game
+    if removed {
+      delete(currentGames, key)
+      cleared++
+    }
+    currentGamesMu.Unlock()
+    unlock()
+
+    if removed {
+      game.Forfeit(user)
+    }
+  }
+  return cleared
+}
+
+// Gets the ongoing game between userA and userB, in either order. The
+// second return value reports whether such a game exists.
+func GetGame(userA string, userB string) (*GameState, bool) {
+  key := getUserPairKey(userA, userB)
+  currentGamesMu.RLock()
+  game, ok := currentGames[key]
+  currentGamesMu.RUnlock()
+  return game, ok
 }
 
 /**
- * Checks if the game is over. A game is over if either the 
- * current player has won (boardSize number of pieces in either 
- * the current row, column, or diagonal), or the board is full.
+ * Gets the opponents of every ongoing game user is playing, sorted by name. 
+ * Each opponent of a game with more than two players is listed.
  */
-func checkGameOver(game *GameState, x int, y int) GameResult {
-  if game.currentPiece == O {
-    diag := getDiag(x, y)
-    diagWin := diag >= 0 && game.oCounts.diags[diag] == boardSize
-    rowWin := game.oCounts.rows[x] == boardSize
-    colWin := game.oCounts.cols[y] == boardSize
+func GamesForUser(user string) []string {
+  opponents := []string{}
+  currentGamesMu.RLock()
+  for key := range currentGames {
+    users, _ := parseUsersKey(key)
+    for i, u := range users {
+      if u == user {
+        opponents = append(opponents, users[:i]...)
+        opponents = append(opponents, users[i + 1:]...)
+      }
+    }
+  }
+  currentGamesMu.RUnlock()
 
-    if diagWin || rowWin || colWin {
-      return OWin
+  sort.Strings(opponents)
+  return opponents
+}
+
+// A snapshot of one stored game, as listed by AllGames.
+type GameListing struct {
+  // The game's key in currentGames.
+  Key string
+  // Username of the player who must make the next move.
+  Current string
+  // Number of pieces on the board.
+  Pieces int
+  Result GameResult
+}
+
+// Gets a listing of every game in currentGames, sorted by key, e.g. for an 
+// admin dashboard.
+func AllGames() []GameListing {
+  currentGamesMu.RLock()
+  games := make([]*GameState, 0, len(currentGames))
+  for _, game := range currentGames {
+    games = append(games, game)
+  }
+  currentGamesMu.RUnlock()
+
+  listings := make([]GameListing, len(games))
+  for i, game := range games {
+    game.mu.Lock()
+    listings[i] = GameListing{Key: game.key, Current: currPlayer(game),
+      Pieces: game.totalPieces, Result: game.result}
+    game.mu.Unlock()
+  }
+  sort.Slice(listings, func(i, j int) bool {
+    return listings[i].Key < listings[j].Key
+  })
+  return listings
+}
+
+/**
+ * Gets a snapshot of the ongoing game between userA and userB for 
+ * spectators. The snapshot is a deep copy, so it is unaffected by later 
+ * moves and changes to it do not affect the live game.
+ */
+func WatchGame(userA string, userB string) (*GameState, error) {
+  game, ok := GetGame(userA, userB)
+  if !ok {
+    return nil, fmt.Errorf("No game between %s and %s.", userA, userB)
+  }
+
+  game.mu.Lock()
+  defer game.mu.Unlock()
+  return game.clone(), nil
+}
+
+/**
+ * Reports which diagonals position (x,y) lies on for a size * size board.
+ * A cell is on the main (top left to bottom right) diagonal if x == y, and
+ * on the anti (top right to bottom left) diagonal if x + y == size - 1. On
+ * odd sized boards the center cell lies on both.
+ */
+func getDiag(x int, y int, size int) (onMain bool, onAnti bool) {
+  return x == y, x + y == size - 1
+}
+
+/**
+ * Checks if the game is over after a piece was placed on (x,y). A game is 
+ * over if either the player owning that piece has won (winLength number of 
+ * consecutive pieces in either the current row, column, or diagonal), one 
+ * of the game's win conditions is met, or the board is full.
+ */
+func checkGameOver(game *GameState, x int, y int) GameResult {
+  size := game.size
+  if game.winLength < size {
+    // The line counts only track full length lines, so scan outwards from 
+    // the new piece for a long enough run instead.
+    if completedRun(game, x, y) != nil {
+      return lineResult(game, game.board[x][y])
     }
   } else {
-    diag := getDiag(x, y)
-    diagWin := diag >= 0 && game.xCounts.diags[diag] == boardSize
-    rowWin := game.xCounts.rows[x] == boardSize
-    colWin := game.xCounts.cols[x] == boardSize
+    p := game.board[x][y]
+    counts := countsFor(game, p)
+    onMain, onAnti := getDiag(x, y, size)
+    diagWin := onMain && counts.diags[0] == size ||
+      onAnti && counts.diags[1] == size
+    rowWin := counts.rows[x] == size
+    colWin := counts.cols[y] == size
 
     if diagWin || rowWin || colWin {
-      return XWin
+      return lineResult(game, p)
+    }
+  }
+
+  last := Move{Piece: game.board[x][y], X: x, Y: y}
+  for _, cond := range game.conditions {
+    winner, ok := cond(game.board, last)
+    if ok && winner >= 0 && int(winner) < len(game.players) {
+      return winResult(winner)
     }
   }
 
   // Every position is filled, but we don't have a winner, so game is a tie.
-  if game.totalCount == boardSize * boardSize {
+  if game.totalPieces == size * size {
     return Tie
   }
 
@@ -163,62 +861,1192 @@ func checkGameOver(game *GameState, x int, y int) GameResult {
 }
 
 /**
- * Makes a move by placing a piece on position (x,y) on the board if valid.
- * Returns the game result - either pending (game is not over), O or X has won, 
- * or the game is a tie.
+ * Gets the result of piece p completing a line, which is a win for p in 
+ * Normal mode and a win for the opponent in Misere mode. Misere mode is 
+ * only played by two players.
  */
-func makeMove(game *GameState, user string, x int, y int) (err, GameResult) {
-  board := game.board
-
-  if user != game.currentPlayer {
-    return fmt.Errorf("It's not player %s's turn", user), Pending
+func lineResult(game *GameState, p Piece) GameResult {
+  if game.mode == Misere {
+    p = otherPiece(p)
   }
+  return winResult(p)
+}
 
-  if x < 0 || x >= boardSize || y < 0 || y >= boardSize {
-    return fmt.Errorf("Board position %d %d is out of range.", x, y), Pending
+// Gets the result of the player with piece p winning.
+func winResult(p Piece) GameResult {
+  switch p {
+  case O:
+    return OWin
+  case X:
+    return XWin
   }
+  return TWin
+}
+
+// Checks if r is a win for one of the players.
+func isWin(r GameResult) bool {
+  return r == OWin || r == XWin || r == TWin
+}
+
+// Gets the username of the player holding piece p, one of the game's 
+// player pieces.
+func pieceOwner(game *GameState, p Piece) string {
+  return game.players[p]
+}
+
+// Gets the username of the player who must make the next move.
+func currPlayer(game *GameState) string {
+  return game.players[game.currPiece]
+}
 
-  if *board[x][y] != B {
-    return fmt.Errorf("Board position %d %d is not empty.", x, y), Pending
+// Gets the piece of the player whose turn comes after the player holding 
+// piece p.
+func nextPiece(game *GameState, p Piece) Piece {
+  return Piece((int(p) + 1) % len(game.players))
+}
+
+// Gets the piece of the player who won with result r, which must be a win.
+func winningPiece(r GameResult) Piece {
+  switch r {
+  case OWin:
+    return O
+  case XWin:
+    return X
   }
+  return T
+}
 
-  *board[x][y] = game.currentPiece
-  game.totalPieces++
+/**
+ * Gets the positions of a line through (x,y) that is filled with the piece 
+ * on (x,y), checking the row, column, and then both diagonals. Returns nil 
+ * if no such line is complete. If winLength is less than size, the line is 
+ * the run found by completedRun instead.
+ */
+func completedLine(game *GameState, x int, y int) [][2]int {
+  size := game.size
+  if game.winLength < size {
+    return completedRun(game, x, y)
+  }
+  counts := countsFor(game, game.board[x][y])
+  onMain, onAnti := getDiag(x, y, size)
 
-  if game.currentPiece == O {
-    game.oCounts.rows[x]++
-    game.oCounts.cols[y]++
-    diag := getDiag(x, y)
-    if diag >= 0 {
-      game.oCounts.diags[diag]++
+  line := make([][2]int, size)
+  for i := 0; i < size; i++ {
+    switch {
+    case counts.rows[x] == size:
+      line[i] = [2]int{x, i}
+    case counts.cols[y] == size:
+      line[i] = [2]int{i, y}
+    case onMain && counts.diags[0] == size:
+      line[i] = [2]int{i, i}
+    case onAnti && counts.diags[1] == size:
+      line[i] = [2]int{i, size - 1 - i}
+    default:
+      return nil
     }
-  } else {
-    game.xCounts.rows[x]++
-    game.xCounts.cols[y]++
-    diag := getDiag(x, y)
-    if diag >= 0 {
-      game.xCounts.diags[diag]++
+  }
+  return line
+}
+
+/**
+ * Ends the game with result, which the piece placed on (x,y) brought about. 
+ * If the piece completed a line, the line and the number of lines it 
+ * completed at once are recorded too.
+ */
+func finishGame(game *GameState, result GameResult, x int, y int) {
+  game.result = result
+  game.endedByMove = true
+  game.winningLine = completedLine(game, x, y)
+  game.winLines = countCompletedLines(game, x, y)
+}
+
+/**
+ * Counts the lines through (x,y) that the piece on (x,y) completes, out of 
+ * its row, its column, and both diagonals. When winLength is less than 
+ * size, runs of at least winLength count as completed lines.
+ */
+func countCompletedLines(game *GameState, x int, y int) int {
+  p := game.board[x][y]
+  lines := 0
+  if game.winLength < game.size {
+    for _, d := range lineDirections {
+      run := 1
+      for _, sign := range []int{-1, 1} {
+        cx, cy := x + sign * d[0], y + sign * d[1]
+        for onBoard(game.size, cx, cy) && game.board[cx][cy] == p {
+          run++
+          cx, cy = cx + sign * d[0], cy + sign * d[1]
+        }
+      }
+      if run >= game.winLength {
+        lines++
+      }
     }
+    return lines
   }
 
-  // If game is over, we simply return the result (either a player has won 
-  // or we have a tie).
-  gameResult := checkGameOver(game, x, y)
-  if gameResult != Pending {
-    return nil, gameResult
+  counts := countsFor(game, p)
+  onMain, onAnti := getDiag(x, y, game.size)
+  for _, full := range []bool{
+    counts.rows[x] == game.size,
+    counts.cols[y] == game.size,
+    onMain && counts.diags[0] == game.size,
+    onAnti && counts.diags[1] == game.size,
+  } {
+    if full {
+      lines++
+    }
   }
+  return lines
+}
 
-  // Change the current piece to the other one.
-  if game.currentPiece == O {
-    game.currentPiece = X
-  } else {
-    game.currentPiece = O
+// Directions to step in along a row, a column, the main diagonal, and the 
+// anti-diagonal.
+var lineDirections = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// Checks if position (x,y) is on a size * size board.
+func onBoard(size int, x int, y int) bool {
+  return x >= 0 && x < size && y >= 0 && y < size
+}
+
+/**
+ * Gets the positions of a run of at least winLength consecutive pieces 
+ * through (x,y) matching the piece on (x,y), checking the row, column, and 
+ * then both diagonals. The whole run is returned, so it may be longer than 
+ * winLength. Returns nil if there is no such run.
+ */
+func completedRun(game *GameState, x int, y int) [][2]int {
+  p := game.board[x][y]
+  for _, d := range lineDirections {
+    // Walk back to the start of the run, then forward to collect it.
+    sx, sy := x, y
+    for onBoard(game.size, sx - d[0], sy - d[1]) &&
+        game.board[sx - d[0]][sy - d[1]] == p {
+      sx, sy = sx - d[0], sy - d[1]
+    }
+
+    var run [][2]int
+    for onBoard(game.size, sx, sy) && game.board[sx][sy] == p {
+      run = append(run, [2]int{sx, sy})
+      sx, sy = sx + d[0], sy + d[1]
+    }
+    if len(run) >= game.winLength {
+      return run
+    }
   }
+  return nil
+}
 
-  // Now it's nextPlayer's turn, so we swap currentPlayer and nextPlayer.
-  game.currentPlayer = game.nextPlayer
-  game.nextPlayer = user
+/**
+ * Checks if last, a move already on the board, ended the game, like 
+ * checkGameOver but by scanning outwards from the last cell along its row, 
+ * column, and diagonals without allocating, so the cost is O(size) per 
+ * move whatever the win length. Custom win conditions are not checked. 
+ * Returns Pending if last's piece is not on its position.
+ */
+func (g *GameState) CheckWinFast(last Move) GameResult {
+  g.mu.Lock()
+  defer g.mu.Unlock()
 
-  return nil, Pending
+  if !onBoard(g.size, last.X, last.Y) || last.Piece == B ||
+      g.board[last.X][last.Y] != last.Piece {
+    return Pending
+  }
+  for _, d := range lineDirections {
+    run := 1 + runLength(g, last.X, last.Y, d[0], d[1]) +
+      runLength(g, last.X, last.Y, -d[0], -d[1])
+    if run >= g.winLength {
+      return lineResult(g, last.Piece)
+    }
+  }
+  if g.totalPieces == g.size * g.size {
+    return Tie
+  }
+  return Pending
+}
+
+// Counts the pieces matching the one on (x,y) in a row from (x,y) in 
+// direction (dx,dy), not counting (x,y) itself.
+func runLength(game *GameState, x int, y int, dx int, dy int) int {
+  p := game.board[x][y]
+  n := 0
+  for x, y = x + dx, y + dy; onBoard(game.size, x, y) &&
+      game.board[x][y] == p; x, y = x + dx, y + dy {
+    n++
+  }
+  return n
 }
 
+// Gets the opposing player's piece in a two-player game.
+func otherPiece(p Piece) Piece {
+  if p == O {
+    return X
+  }
+  return O
+}
+
+/**
+ * Updates the row, column, and diagonal counts of the player owning piece p 
+ * for a piece added (delta 1) or removed (delta -1) at position (x,y).
+ */
+func updateCounts(game *GameState, p Piece, x int, y int, delta int) {
+  counts := countsFor(game, p)
+  counts.rows[x] += delta
+  counts.cols[y] += delta
+  onMain, onAnti := getDiag(x, y, game.size)
+  if onMain {
+    counts.diags[0] += delta
+  }
+  if onAnti {
+    counts.diags[1] += delta
+  }
+}
+
+// Places piece p on the empty position (x,y), updating the piece counts.
+func placePiece(game *GameState, p Piece, x int, y int) {
+  game.board[x][y] = p
+  game.totalPieces++
+  updateCounts(game, p, x, y, 1)
+}
+
+// Removes the piece on position (x,y), reverting placePiece.
+func removePiece(game *GameState, x int, y int) {
+  updateCounts(game, game.board[x][y], x, y, -1)
+  game.board[x][y] = B
+  game.totalPieces--
+}
+
+/**
+ * Makes a move by placing a piece on position (x,y) on the board if valid.
+ * Returns the game result - either pending (game is not over), O or X has won, 
+ * or the game is a tie. An invalid move is reported with the first error 
+ * ValidateMove finds, so e.g. any move on a finished game reports 
+ * ErrGameOver, even if it is out of turn or off the board.
+ */
+func makeMove(game *GameState, user string, x int, y int) (error, GameResult) {
+  return runMove(game, func() (error, GameResult) {
+    return applyMove(game, user, x, y)
+  })
+}
+
+/**
+ * Runs apply, which makes one or more moves on game, with the game locked. 
+ * If it succeeds, the result is recorded in user statistics if it ends the 
+ * game, and each move made is queued for the game's subscribers. The 
+ * game's callbacks are then called for each move made, once the pair lock 
+ * is released, so that they may make moves on the game themselves. 
+ * Finally, a game that the moves ended is released from currentGames.
+ */
+func runMove(game *GameState, apply func() (error, GameResult)) (error,
+    GameResult) {
+  unlock := lockPair(game.key)
+  err, gameResult, notify := runMoveLocked(game, apply)
+  unlock()
+  notify()
+  return err, gameResult
+}
+
+/**
+ * Runs a move like runMove, for callers already holding the pair lock. 
+ * Returns a function calling the callbacks for the moves made and then 
+ * releasing a game they ended, which the caller must call after releasing 
+ * the pair lock.
+ */
+func runMoveLocked(game *GameState, apply func() (error, GameResult)) (error,
+    GameResult, func()) {
+  game.mu.Lock()
+  made := len(game.history)
+  err, gameResult := apply()
+  // A game that was already over, e.g. given an empty batch of moves or a 
+  // rejected move, is not counted or released again.
+  ended := err == nil && gameResult != Pending && len(game.history) > made
+  if ended && !game.detached {
+    recordStats(game)
+  }
+  callbacks := game.callbacks
+  var moves []Move
+  if err == nil {
+    moves = append(moves, game.history[made:]...)
+  }
+  // Queueing while the game is locked keeps subscribers in move order.
+  for _, move := range moves {
+    for _, sub := range game.subscribers {
+      sub.send(move)
+    }
+  }
+  if gameResult != Pending {
+    closeSubscribers(game)
+  }
+  game.mu.Unlock()
+
+  return err, gameResult, func() {
+    for i, move := range moves {
+      // Only the last move can have ended the game.
+      result := Pending
+      if i == len(moves) - 1 {
+        result = gameResult
+      }
+      for _, fn := range callbacks {
+        fn(game, move, result)
+      }
+    }
+    // Released only once the callbacks are done, so the last move's 
+    // callbacks can still find the game.
+    if ended {
+      releaseGame(game)
+    }
+  }
+}
+
+// A move by a user on position (X,Y), as given to ApplyMoves.
+type UserMove struct {
+  User string
+  X, Y int
+}
+
+/**
+ * Makes each of moves in order like makeMove, all or nothing. If any move 
+ * is invalid, the game is rolled back to its state before the call and 
+ * the error for that move is returned, with no statistics recorded or 
+ * callbacks called. Otherwise callbacks are called for each move in turn. 
+ * An empty batch changes nothing, even on a finished game.
+ */
+func (g *GameState) ApplyMoves(moves []UserMove) error {
+  err, _ := runMove(g, func() (error, GameResult) {
+    before := g.clone()
+    result := g.result
+    for i, m := range moves {
+      var err error
+      if err, result = applyMove(g, m.User, m.X, m.Y); err != nil {
+        restore(g, before)
+        return fmt.Errorf("move %d: %w", i + 1, err), g.result
+      }
+    }
+    return nil, result
+  })
+  return err
+}
+
+// A move made by MakeMoveWithID, with its index in the history and the 
+// result it got.
+type idMove struct {
+  index int
+  result GameResult
+}
+
+/**
+ * Makes a move like makeMove, identified by moveID so that retries of the 
+ * same move are only applied once. If a move with moveID was already made, 
+ * the result it got is returned again and the game is left untouched. A 
+ * move that fails is not recorded, so it may be retried with the same ID, 
+ * and neither is one taken back by Undo.
+ */
+func (g *GameState) MakeMoveWithID(user string, moveID string, x int,
+    y int) (error, GameResult) {
+  unlock := lockPair(g.key)
+  g.mu.Lock()
+  prior, done := g.moveIDs[moveID]
+  g.mu.Unlock()
+  if done {
+    unlock()
+    return nil, prior.result
+  }
+
+  err, result, notify := runMoveLocked(g, func() (error, GameResult) {
+    err, result := applyMove(g, user, x, y)
+    if err == nil {
+      if g.moveIDs == nil {
+        g.moveIDs = map[string]idMove{}
+      }
+      g.moveIDs[moveID] = idMove{index: len(g.history) - 1, result: result}
+    }
+    return err, result
+  })
+  unlock()
+  notify()
+  return err, result
+}
+
+/**
+ * Checks if user may place their piece on position (x,y), without changing 
+ * the game. Returns a *MoveError wrapping ErrGameOver, ErrGamePaused, 
+ * ErrNotYourTurn, ErrOutOfRange, or ErrCellOccupied if not, checked in that 
+ * order. Every way of making a move checks in this order, so that the most 
+ * general reason a move is rejected is the one reported.
+ */
+func (g *GameState) ValidateMove(user string, x int, y int) error {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return validateMove(g, user, x, y)
+}
+
+// Checks a move like ValidateMove, for callers already holding game.mu.
+func validateMove(game *GameState, user string, x int, y int) error {
+  if game.result != Pending {
+    return newMoveError(ErrGameOver, "game result " + game.result.String())
+  }
+
+  if game.paused {
+    return newMoveError(ErrGamePaused, "")
+  }
+
+  if user != currPlayer(game) {
+    return newMoveError(ErrNotYourTurn, "player " + user)
+  }
+
+  if !onBoard(game.size, x, y) {
+    return newMoveError(ErrOutOfRange,
+      fmt.Sprintf("board position %d %d", x, y))
+  }
+
+  if game.board[x][y] != B {
+    return newMoveError(ErrCellOccupied,
+      fmt.Sprintf("board position %d %d", x, y))
+  }
+  return nil
+}
+
+// Makes a move like makeMove, for callers already holding game.mu. Unlike 
+// makeMove, user statistics and callbacks are left untouched.
+func applyMove(game *GameState, user string, x int, y int) (error, GameResult) {
+  if err := validateMove(game, user, x, y); err != nil {
+    return err, game.result
+  }
+
+  placePiece(game, game.currPiece, x, y)
+  game.history = append(game.history, Move{Piece: game.currPiece, X: x, Y: y})
+
+  recordPosition(game)
+
+  // Moving withdraws the mover's draw offer.
+  if game.drawOffer == user {
+    game.drawOffer = ""
+  }
+
+  // If game is over, we simply return the result (either a player has won 
+  // or we have a tie).
+  gameResult := checkGameOver(game, x, y)
+  if gameResult != Pending {
+    finishGame(game, gameResult, x, y)
+    return nil, gameResult
+  }
+
+  // Now it's the next player's turn.
+  game.currPiece = nextPiece(game, game.currPiece)
+
+  return nil, Pending
+}
+
+// Gets the most recent move, and whether any move has been played yet.
+func (g *GameState) LastMove() (Move, bool) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  if len(g.history) == 0 {
+    return Move{}, false
+  }
+  return g.history[len(g.history) - 1], true
+}
+
+/**
+ * Takes back the last move, clearing its board position and restoring the 
+ * piece counts and turn to how they were before the move was made. Since 
+ * a move can only be made on a pending game, the game is pending again 
+ * afterwards, with no winning line. If the move ended the game, its result 
+ * is taken back out of user statistics, and a game released from 
+ * currentGames is stored again unless it has since been replaced or 
+ * cleared. An ID the move 
+ * was made with by MakeMoveWithID is forgotten, so a retry makes it again. 
+ * Returns an error if no moves have been played, or if the game was ended 
+ * some other way, e.g. by a forfeit, an agreed draw, or running out of 
+ * time.
+ */
+func (g *GameState) Undo() error {
+  unlock := lockPair(g.key)
+  defer unlock()
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if len(g.history) == 0 {
+    return fmt.Errorf("There are no moves to undo.")
+  }
+  if g.result != Pending && !g.endedByMove {
+    return fmt.Errorf("Game result %s was not reached by a move, so it " +
+      "cannot be undone.", g.result)
+  }
+  if g.counted {
+    unrecordStats(g)
+  }
+
+  last := g.history[len(g.history) - 1]
+  g.history = g.history[:len(g.history) - 1]
+  // A retry of the undone move should make it again.
+  for id, m := range g.moveIDs {
+    if m.index == len(g.history) {
+      delete(g.moveIDs, id)
+    }
+  }
+  // The undone board did not really occur, so it no longer counts.
+  if h := g.board.Hash(); g.positions[h] > 1 {
+    g.positions[h]--
+  } else {
+    delete(g.positions, h)
+  }
+  removePiece(g, last.X, last.Y)
+  wasOver := g.result != Pending
+  g.result = Pending
+  g.endedByMove = false
+  g.winningLine = nil
+  g.winLines = 0
+
+  // Hand the turn back, which a move that ended the game never passed on. 
+  // Forced pieces never took the turn in the first place.
+  if !last.Forced {
+    g.currPiece = last.Piece
+  }
+
+  if wasOver && !g.detached {
+    currentGamesMu.Lock()
+    // Only the game released last is stored again, not one that has since 
+    // been cleared or followed by another game.
+    if lastGames[g.key] == g {
+      currentGames[g.key] = g
+      delete(lastGames, g.key)
+    }
+    currentGamesMu.Unlock()
+  }
+  return nil
+}
+
+/**
+ * Applies the pie rule on behalf of user, the second player, right after 
+ * the first move: user takes over the first player's piece and the move 
+ * made with it, and the first player moves next with the second piece. 
+ * Clocks follow their players. Returns an error unless the game is a 
+ * pending two-player game with exactly one move played and it is user's 
+ * turn.
+ */
+func (g *GameState) ApplyPieRule(user string) error {
+  unlock := lockPair(g.key)
+  defer unlock()
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if g.result != Pending {
+    return fmt.Errorf("game result %s: %w", g.result, ErrGameOver)
+  }
+  if len(g.players) != 2 {
+    return fmt.Errorf("The pie rule needs a two-player game.")
+  }
+  if len(g.history) != 1 {
+    return fmt.Errorf("The pie rule only applies after the first move, " +
+      "but %d moves have been played.", len(g.history))
+  }
+  if user != currPlayer(g) {
+    return fmt.Errorf("player %s: %w", user, ErrNotYourTurn)
+  }
+
+  // Pieces stay put, so swapping their owners hands the turn back to the 
+  // first player.
+  g.players[O], g.players[X] = g.players[X], g.players[O]
+  if g.remaining != nil {
+    g.remaining[O], g.remaining[X] = g.remaining[X], g.remaining[O]
+  }
+  return nil
+}
+
+// Lists all empty board positions (x,y) in row-major order.
+func validMoves(game *GameState) [][2]int {
+  moves := make([][2]int, 0, game.size * game.size - game.totalPieces)
+  for i := 0; i < game.size; i++ {
+    for j := 0; j < game.size; j++ {
+      if game.board[i][j] == B {
+        moves = append(moves, [2]int{i, j})
+      }
+    }
+  }
+  return moves
+}
+
+/**
+ * Gets all positions (x,y) where a piece can legally be placed, in 
+ * row-major order. Returns an empty slice if the board is full.
+ */
+func (g *GameState) GetValidMoves() [][2]int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return validMoves(g)
+}
+
+/**
+ * Places piece p on position (x,y) regardless of whose turn it is, for 
+ * setting up puzzles. The turn is not checked or passed on, but the piece 
+ * is recorded in the move history as a Forced move, so that it is undone, 
+ * summarized, and exported like any other. Callbacks and subscribers are 
+ * told of it too. A completed line or full board still ends the game, 
+ * which is then finished like a game ended by a move. Returns a 
+ * *MoveError wrapping ErrGameOver, ErrUnknownPiece, ErrOutOfRange, or 
+ * ErrCellOccupied if the piece cannot be placed.
+ */
+func (g *GameState) ForceMove(p Piece, x int, y int) error {
+  err, _ := runMove(g, func() (error, GameResult) {
+    return forceMove(g, p, x, y), g.result
+  })
+  return err
+}
+
+// Places a piece like ForceMove, for callers already holding game.mu. 
+// Unlike ForceMove, user statistics and callbacks are left untouched.
+func forceMove(game *GameState, p Piece, x int, y int) error {
+  if game.result != Pending {
+    return newMoveError(ErrGameOver, "game result " + game.result.String())
+  }
+  if p < 0 || int(p) >= len(game.players) {
+    return newMoveError(ErrUnknownPiece, "piece " + p.String())
+  }
+  if !onBoard(game.size, x, y) {
+    return newMoveError(ErrOutOfRange,
+      fmt.Sprintf("board position %d %d", x, y))
+  }
+  if game.board[x][y] != B {
+    return newMoveError(ErrCellOccupied,
+      fmt.Sprintf("board position %d %d", x, y))
+  }
+
+  placePiece(game, p, x, y)
+  game.history = append(game.history, Move{Piece: p, X: x, Y: y,
+    Forced: true})
+  recordPosition(game)
+  if result := checkGameOver(game, x, y); result != Pending {
+    finishGame(game, result, x, y)
+  }
+  return nil
+}
+
+/**
+ * Makes a move like makeMove, but fails without placing a piece if ctx is 
+ * already cancelled or past its deadline, e.g. because the player ran out 
+ * of time to move, with a *MoveError wrapping ctx's error. A move on a 
+ * finished game still reports ErrGameOver first, as with every other way 
+ * of making a move.
+ */
+func MakeMoveContext(ctx context.Context, game *GameState, user string, x int,
+    y int) (error, GameResult) {
+  if err := ctx.Err(); err != nil {
+    game.mu.Lock()
+    defer game.mu.Unlock()
+    if game.result != Pending {
+      return validateMove(game, user, x, y), game.result
+    }
+    return newMoveError(err, "player " + user), game.result
+  }
+  return makeMove(game, user, x, y)
+}
+
+/**
+ * Ends the game with user conceding, so their opponent wins, or with more 
+ * than two players, the player whose turn comes after user's. Returns the 
+ * game result, which is left unchanged if the game is already over or user 
+ * is not one of the players. Forfeits are not counted in user statistics, 
+ * and release the game from currentGames like a move ending it.
+ */
+func (g *GameState) Forfeit(user string) GameResult {
+  unlock := lockPair(g.key)
+  defer unlock()
+  g.mu.Lock()
+  if g.result != Pending {
+    defer g.mu.Unlock()
+    return g.result
+  }
+
+  for i, player := range g.players {
+    if player == user {
+      g.result = winResult(nextPiece(g, Piece(i)))
+    }
+  }
+  result := g.result
+  if result != Pending {
+    closeSubscribers(g)
+  }
+  g.mu.Unlock()
+
+  if result != Pending {
+    releaseGame(g)
+  }
+  return result
+}
+
+/**
+ * Registers fn to be called after each successful move. Callbacks are 
+ * called in the order they were registered, after the move's locks are 
+ * released, so fn may read the game or make the next move itself. Callbacks 
+ * for successive moves made from different goroutines may then overlap.
+ */
+func (g *GameState) OnMove(fn MoveCallback) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  g.callbacks = append(g.callbacks, fn)
+}
+
+/**
+ * Gets a channel that is sent each successful move made from now on, in 
+ * order, and closed after the last one once a move, forfeit, or agreed draw 
+ * ends the game. Every call gets its own channel. Moves queue up until they 
+ * are received, so a slow subscriber never holds up play, but an abandoned 
+ * one keeps its queue until the game is over. The channel is closed 
+ * immediately if the game is already over.
+ */
+func (g *GameState) Subscribe() <-chan Move {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  sub := newSubscriber()
+  if g.result != Pending {
+    sub.close()
+    return sub.ch
+  }
+  g.subscribers = append(g.subscribers, sub)
+  return sub.ch
+}
+
+// Closes and forgets the game's subscribers now that it is over, for 
+// callers holding game.mu. Moves already queued are still delivered.
+func closeSubscribers(game *GameState) {
+  for _, sub := range game.subscribers {
+    sub.close()
+  }
+  game.subscribers = nil
+}
+
+/**
+ * A channel returned by Subscribe, along with the moves queued for it. Its 
+ * own goroutine delivers the queue in order, so queueing never blocks.
+ */
+type subscriber struct {
+  ch chan Move
+  // Guards the fields below.
+  mu sync.Mutex
+  // Signalled when a move is queued or the subscriber is closed.
+  wake *sync.Cond
+  queue []Move
+  closed bool
+}
+
+// Creates a subscriber and starts delivering its moves.
+func newSubscriber() *subscriber {
+  sub := &subscriber{ch: make(chan Move)}
+  sub.wake = sync.NewCond(&sub.mu)
+  go sub.deliver()
+  return sub
+}
+
+// Queues m to be sent on the subscriber's channel.
+func (s *subscriber) send(m Move) {
+  s.mu.Lock()
+  s.queue = append(s.queue, m)
+  s.mu.Unlock()
+  s.wake.Signal()
+}
+
+// Closes the subscriber's channel once every queued move has been sent.
+func (s *subscriber) close() {
+  s.mu.Lock()
+  s.closed = true
+  s.mu.Unlock()
+  s.wake.Signal()
+}
+
+// Sends queued moves on the channel until the subscriber is closed and its 
+// queue is empty, then closes the channel.
+func (s *subscriber) deliver() {
+  for {
+    s.mu.Lock()
+    for len(s.queue) == 0 && !s.closed {
+      s.wake.Wait()
+    }
+    if len(s.queue) == 0 {
+      s.mu.Unlock()
+      close(s.ch)
+      return
+    }
+    m := s.queue[0]
+    s.queue = s.queue[1:]
+    s.mu.Unlock()
+    s.ch <- m
+  }
+}
+
+// Gets the number of lines completed at once by the move that won the game, 
+// e.g. 2 for a move completing both a row and a column, or 0 if the game 
+// has not been won.
+func (g *GameState) WinLineCount() int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return g.winLines
+}
+
+// Pauses the game so that moves are rejected until it is resumed. Pausing 
+// a game that is already over does nothing.
+func (g *GameState) Pause() {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  if g.result == Pending {
+    g.paused = true
+  }
+}
+
+// Resumes a paused game so that moves are accepted again.
+func (g *GameState) Resume() {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  g.paused = false
+}
+
+// Gets the username of the player who won the game, and whether the game 
+// has been won at all, so the second value is false for ties and pending 
+// games.
+func (g *GameState) WinnerUser() (string, bool) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return winnerUser(g)
+}
+
+// Gets the winner like WinnerUser, for callers already holding game.mu.
+func winnerUser(game *GameState) (string, bool) {
+  if !isWin(game.result) {
+    return "", false
+  }
+  // Players keep their pieces for the whole game, so this holds whether or 
+  // not the last move passed the turn.
+  return pieceOwner(game, winningPiece(game.result)), true
+}
+
+/**
+ * Gets the username of the player who lost the game, and whether there is 
+ * one, so the second value is false for ties and pending games. Games with 
+ * more than two players have no single loser, so it is false for them too.
+ */
+func (g *GameState) LoserUser() (string, bool) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if !isWin(g.result) || len(g.players) != 2 {
+    return "", false
+  }
+  return pieceOwner(g, otherPiece(winningPiece(g.result))), true
+}
+
+// Gets the piece user plays with, or an error if user is not one of the 
+// players.
+func (g *GameState) PieceOf(user string) (Piece, error) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  for i, player := range g.players {
+    if player == user {
+      return Piece(i), nil
+    }
+  }
+  return B, fmt.Errorf("Player %s is not in the game.", user)
+}
+
+/**
+ * Gets the username and piece of the player who must make the next move. 
+ * The turn is not passed on by a move that ends the game, so once the game 
+ * is over this is the player who made the last move, or who was to move if 
+ * the game ended some other way, e.g. by forfeit.
+ */
+func (g *GameState) CurrentPlayer() (user string, piece Piece) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return currPlayer(g), g.currPiece
+}
+
+// Gets the result of the game, which is Pending until the game is over.
+func (g *GameState) Result() GameResult {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return g.result
+}
+
+// Gets the positions of the line that won the game, or nil if the game has 
+// not been won.
+func (g *GameState) WinningLine() [][2]int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return append([][2]int(nil), g.winningLine...)
+}
+
+// Checks if position (x,y) is part of the line that won the game, which is 
+// never the case while the game is still being played.
+func (g *GameState) CellInWinningLine(x int, y int) bool {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if !isWin(g.result) {
+    return false
+  }
+  for _, pos := range g.winningLine {
+    if pos == [2]int{x, y} {
+      return true
+    }
+  }
+  return false
+}
+
+// Attaches value v to the game under key k, e.g. a room id or tournament 
+// round, replacing any value already under k.
+func (g *GameState) SetMeta(k string, v string) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  if g.meta == nil {
+    g.meta = map[string]string{}
+  }
+  g.meta[k] = v
+}
+
+// Gets the value attached to the game under key k. The second return value 
+// reports whether there is one.
+func (g *GameState) GetMeta(k string) (string, bool) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  v, ok := g.meta[k]
+  return v, ok
+}
+
+// Gets the number of rows and columns on the board.
+func (g *GameState) Size() int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return g.size
+}
+
+/**
+ * Calls fn with each board position (x,y) and the piece on it, in row-major 
+ * order. fn sees a snapshot of the board taken before the first call, so it 
+ * may safely use the game itself.
+ */
+func (g *GameState) EachCell(fn func(x int, y int, p Piece)) {
+  g.mu.Lock()
+  board := g.board.clone()
+  g.mu.Unlock()
+
+  for i := range board {
+    for j := range board[i] {
+      fn(i, j, board[i][j])
+    }
+  }
+}
+
+// Gets the number of empty positions left on the board.
+func (g *GameState) RemainingCells() int {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return g.size * g.size - g.totalPieces
+}
+
+// Gets the most moves that can still be made before the board fills, the 
+// same as RemainingCells, regardless of whether a win ends the game first.
+func (g *GameState) MovesRemaining() int {
+  return g.RemainingCells()
+}
+
+// Gets the piece on board position (x,y), or an error wrapping 
+// ErrOutOfRange if the position is not on the board.
+func (g *GameState) Cell(x int, y int) (Piece, error) {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  if x < 0 || x >= g.size || y < 0 || y >= g.size {
+    return B, fmt.Errorf("board position %d %d: %w", x, y, ErrOutOfRange)
+  }
+  return g.board[x][y], nil
+}
+
+/**
+ * Resets the game in place to a new game between userA (playing O and 
+ * moving first) and userB (playing X) on the same size board, reusing its 
+ * board and piece counts rather than allocating new ones, e.g. to recycle 
+ * games from a pool. Every other setting, including callbacks, is cleared 
+ * back to that of a new game, and subscriber channels are closed. The game 
+ * is not stored in currentGames afterwards, and a finished game kept for a 
+ * rematch is forgotten. Returns an error and leaves the game unchanged if 
+ * either username is empty or they are the same, or if the game is still 
+ * stored in currentGames, since its key would change under it.
+ */
+func (g *GameState) Reset(userA string, userB string) error {
+  users := []string{userA, userB}
+  if err := checkUsers(users); err != nil {
+    return err
+  }
+
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  currentGamesMu.Lock()
+  stored := currentGames[g.key] == g
+  if !stored && lastGames[g.key] == g {
+    delete(lastGames, g.key)
+  }
+  currentGamesMu.Unlock()
+  if stored {
+    return fmt.Errorf("The game between %s is still stored, so it cannot " +
+      "be reset.", strings.Join(g.players, " and "))
+  }
+
+  closeSubscribers(g)
+  g.key = getUsersKey(users)
+  g.winLength = g.size
+  initBoard(g.board)
+  g.players = append(g.players[:0], users...)
+  g.currPiece = O
+  if cap(g.counts) < len(users) {
+    g.counts = make([]PlayerCounts, len(users))
+  }
+  g.counts = g.counts[:len(users)]
+  for i := range g.counts {
+    c := &g.counts[i]
+    if len(c.rows) != g.size {
+      *c = newPlayerCounts(g.size)
+      continue
+    }
+    for j := range c.rows {
+      c.rows[j], c.cols[j] = 0, 0
+    }
+    c.diags = [2]int{}
+  }
+  g.totalPieces = 0
+  g.history = g.history[:0]
+  g.result = Pending
+  g.endedByMove = false
+  g.counted = false
+  g.mode = Normal
+  g.winningLine = nil
+  g.winLines = 0
+  g.paused = false
+  g.remaining = nil
+  g.conditions = nil
+  g.meta = nil
+  g.moveIDs = nil
+  g.drawOffer = ""
+  g.positions = nil
+  recordPosition(g)
+  g.callbacks = nil
+  return nil
+}
+
+/**
+ * Makes a deep copy of the game, including its board, piece counts, and 
+ * history, so that moves made on the copy do not affect the original. The 
+ * copy is detached: finishing it records no statistics and it is never 
+ * stored in or removed from the current games.
+ */
+func (g *GameState) Clone() *GameState {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return g.clone()
+}
+
+// Copies the game like Clone, for callers already holding g.mu.
+func (g *GameState) clone() *GameState {
+  return &GameState{
+    key: g.key,
+    size: g.size,
+    winLength: g.winLength,
+    board: g.board.clone(),
+    players: append([]string(nil), g.players...),
+    currPiece: g.currPiece,
+    counts: cloneCounts(g.counts),
+    totalPieces: g.totalPieces,
+    history: append([]Move(nil), g.history...),
+    result: g.result,
+    endedByMove: g.endedByMove,
+    mode: g.mode,
+    winningLine: append([][2]int(nil), g.winningLine...),
+    winLines: g.winLines,
+    paused: g.paused,
+    remaining: cloneClock(g.remaining),
+    conditions: g.conditions,
+    meta: cloneMeta(g.meta),
+    moveIDs: cloneMoveIDs(g.moveIDs),
+    drawOffer: g.drawOffer,
+    positions: clonePositions(g.positions),
+    detached: true,
+  }
+}
+
+// Sets the state of the game back to that of snap, a clone of it, leaving 
+// the lock, callbacks, subscribers, and whether it is counted or detached 
+// alone.
+func restore(g *GameState, snap *GameState) {
+  g.key = snap.key
+  g.size = snap.size
+  g.winLength = snap.winLength
+  g.board = snap.board
+  g.players = snap.players
+  g.currPiece = snap.currPiece
+  g.counts = snap.counts
+  g.totalPieces = snap.totalPieces
+  g.history = snap.history
+  g.result = snap.result
+  g.endedByMove = snap.endedByMove
+  g.mode = snap.mode
+  g.winningLine = snap.winningLine
+  g.winLines = snap.winLines
+  g.paused = snap.paused
+  g.remaining = snap.remaining
+  g.conditions = snap.conditions
+  g.meta = snap.meta
+  g.moveIDs = snap.moveIDs
+  g.drawOffer = snap.drawOffer
+  g.positions = snap.positions
+}
+
+func cloneMoveIDs(ids map[string]idMove) map[string]idMove {
+  if ids == nil {
+    return nil
+  }
+  c := make(map[string]idMove, len(ids))
+  for id, m := range ids {
+    c[id] = m
+  }
+  return c
+}
+
+func cloneMeta(meta map[string]string) map[string]string {
+  if meta == nil {
+    return nil
+  }
+  c := make(map[string]string, len(meta))
+  for k, v := range meta {
+    c[k] = v
+  }
+  return c
+}
+
+// Gets a copy of the moves played so far, in order.
+func (g *GameState) History() []Move {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+  return append([]Move(nil), g.history...)
+}
+
+func (b Board) clone() Board {
+  board := newBoard(len(b))
+  for i := range board {
+    copy(board[i], b[i])
+  }
+  return board
+}
+
+func cloneCounts(counts []PlayerCounts) []PlayerCounts {
+  c := make([]PlayerCounts, len(counts))
+  for i := range counts {
+    c[i] = counts[i].clone()
+  }
+  return c
+}
+
+func (c PlayerCounts) clone() PlayerCounts {
+  rows := append([]int(nil), c.rows...)
+  cols := append([]int(nil), c.cols...)
+  return PlayerCounts{rows: rows, cols: cols, diags: c.diags}
+}
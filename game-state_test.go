@@ -0,0 +1,2455 @@
+package tictactoe
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "math/rand"
+  "reflect"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+// Number of test runs so far, so that each run of a test, e.g. with 
+// -count, gets usernames of its own.
+var testRuns int64
+
+// Prefixes for the usernames of each running test, keyed by its T.
+var testNames sync.Map
+
+// Gets a name unique to this run of the test, from which its usernames are 
+// made.
+func testName(t *testing.T) string {
+  name := fmt.Sprintf("%s#%d", t.Name(), atomic.AddInt64(&testRuns, 1))
+  actual, _ := testNames.LoadOrStore(t, name)
+  return actual.(string)
+}
+
+// Gets two usernames unique to the running test, so that tests never share
+// games, locks, or user statistics.
+func testUsers(t *testing.T) (string, string) {
+  return testName(t) + "/a", testName(t) + "/b"
+}
+
+// Starts a default size game between the test's users, failing the test on
+// error.
+func startTestGame(t *testing.T) *GameState {
+  t.Helper()
+  userA, userB := testUsers(t)
+  game, err := startGame(userA, userB)
+  if err != nil {
+    t.Fatalf("startGame: %v", err)
+  }
+  return game
+}
+
+// Makes each of moves in order as whichever player's turn it is, failing
+// the test if one is rejected. Returns the result of the last move.
+func playMoves(t *testing.T, game *GameState, moves ...[2]int) GameResult {
+  t.Helper()
+  result := game.Result()
+  for _, m := range moves {
+    user, _ := game.CurrentPlayer()
+    var err error
+    if err, result = makeMove(game, user, m[0], m[1]); err != nil {
+      t.Fatalf("move %d %d: %v", m[0], m[1], err)
+    }
+  }
+  return result
+}
+
+func TestOnMoveCallbackCanMakeReplyMove(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  game.OnMove(func(g *GameState, m Move, result GameResult) {
+    if m.Piece == O && result == Pending {
+      if err, _ := makeMove(g, userB, 0, 0); err != nil {
+        t.Errorf("reply move: %v", err)
+      }
+    }
+  })
+
+  done := make(chan struct{})
+  go func() {
+    defer close(done)
+    if err, _ := makeMove(game, userA, 1, 1); err != nil {
+      t.Errorf("move: %v", err)
+    }
+  }()
+  select {
+  case <-done:
+  case <-time.After(5 * time.Second):
+    t.Fatal("move deadlocked on a callback making the reply move")
+  }
+  got := game.History()
+  if len(got) != 2 || got[1] != (Move{Piece: X, X: 0, Y: 0}) {
+    t.Fatalf("history %v, want the reply move second", got)
+  }
+}
+
+func TestPairLocksAreDeletedWhenUnused(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0})
+  game.Undo()
+  game.Forfeit(currPlayer(game))
+
+  pairLocksMu.Lock()
+  defer pairLocksMu.Unlock()
+  if _, ok := pairLocks[game.key]; ok {
+    t.Fatalf("pair lock for %q kept after use", game.key)
+  }
+}
+
+func TestConcurrentMovesOnOneGame(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+
+  // Both players race to fill every cell, so most moves are rejected.
+  var wg sync.WaitGroup
+  for _, user := range []string{userA, userB, userA, userB} {
+    wg.Add(1)
+    go func(user string) {
+      defer wg.Done()
+      for x := 0; x < 3; x++ {
+        for y := 0; y < 3; y++ {
+          makeMove(game, user, x, y)
+        }
+      }
+    }(user)
+  }
+  wg.Wait()
+
+  game.mu.Lock()
+  defer game.mu.Unlock()
+  if game.totalPieces != len(game.history) {
+    t.Fatalf("%d pieces placed but %d moves recorded", game.totalPieces,
+      len(game.history))
+  }
+  for i, m := range game.history {
+    if m.Piece != Piece(i % 2) {
+      t.Fatalf("move %d played out of turn: %v", i + 1, m)
+    }
+  }
+}
+
+func TestConcurrentMovesCountSuccesses(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+
+  var wg sync.WaitGroup
+  var mu sync.Mutex
+  made := 0
+  for _, user := range []string{userA, userB} {
+    wg.Add(1)
+    go func(user string) {
+      defer wg.Done()
+      for i := 0; i < 100; i++ {
+        if err, _ := makeMove(game, user, i % 3, i / 3 % 3); err == nil {
+          mu.Lock()
+          made++
+          mu.Unlock()
+        }
+      }
+    }(user)
+  }
+  wg.Wait()
+
+  game.mu.Lock()
+  defer game.mu.Unlock()
+  if game.totalPieces != made {
+    t.Fatalf("%d pieces placed but %d moves succeeded", game.totalPieces, made)
+  }
+}
+
+func TestConcurrentGamesBetweenPairs(t *testing.T) {
+  name := testName(t)
+  var wg sync.WaitGroup
+  for i := 0; i < 16; i++ {
+    wg.Add(1)
+    go func(i int) {
+      defer wg.Done()
+      userA, userB := fmt.Sprintf("%s/%d/a", name, i),
+        fmt.Sprintf("%s/%d/b", name, i)
+      game, err := startGame(userA, userB)
+      if err != nil {
+        t.Error(err)
+        return
+      }
+      GetGame(userA, userB)
+      for _, m := range [][2]int{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0},
+          {1, 2}, {0, 1}, {2, 1}, {2, 2}} {
+        user, _ := game.CurrentPlayer()
+        if err, _ := makeMove(game, user, m[0], m[1]); err != nil {
+          t.Error(err)
+          return
+        }
+      }
+      if result := game.Result(); result != Tie {
+        t.Errorf("game %d: result %s, want a tie", i, result)
+      }
+      ClearGamesForUser(userA)
+    }(i)
+  }
+  wg.Wait()
+}
+
+func TestSubscribeDoesNotBlockMoves(t *testing.T) {
+  game := startTestGame(t)
+  moves := game.Subscribe()
+
+  // Nothing receives until the game is over.
+  want := [][2]int{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0}, {1, 2}, {0, 1},
+    {2, 1}, {2, 2}}
+  if result := playMoves(t, game, want...); result != Tie {
+    t.Fatalf("result %s, want a tie", result)
+  }
+
+  i := 0
+  for m := range moves {
+    if i >= len(want) || [2]int{m.X, m.Y} != want[i] {
+      t.Fatalf("move %d sent as %v", i + 1, m)
+    }
+    i++
+  }
+  if i != len(want) {
+    t.Fatalf("%d moves sent, want %d", i, len(want))
+  }
+}
+
+func TestForceMoveFinishesLikeAMove(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  moves := game.Subscribe()
+  for _, y := range []int{0, 1, 2} {
+    if err := game.ForceMove(X, 0, y); err != nil {
+      t.Fatalf("ForceMove %d: %v", y, err)
+    }
+  }
+
+  if result := game.Result(); result != XWin {
+    t.Fatalf("result %s, want X to win", result)
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("game ended by ForceMove still stored")
+  }
+  if stats := GetStats(userB); stats.Wins != 1 {
+    t.Fatalf("X player stats %+v, want 1 win", stats)
+  }
+  if stats := GetStats(userA); stats.Losses != 1 {
+    t.Fatalf("O player stats %+v, want 1 loss", stats)
+  }
+  n := 0
+  for m := range moves {
+    if !m.Forced {
+      t.Fatalf("move %v not marked forced", m)
+    }
+    n++
+  }
+  if n != 3 {
+    t.Fatalf("%d moves sent, want 3", n)
+  }
+}
+
+func TestForceMoveIsRecordedAndUndone(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  if err := game.ForceMove(O, 0, 0); err != nil {
+    t.Fatal(err)
+  }
+
+  want := []Move{{Piece: O, X: 1, Y: 1}, {Piece: O, X: 0, Y: 0, Forced: true}}
+  if got := game.History(); !reflect.DeepEqual(got, want) {
+    t.Fatalf("history %v, want %v", got, want)
+  }
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if p, _ := game.Cell(0, 0); p != B {
+    t.Fatalf("undone forced piece left %s on the board", p)
+  }
+  // The forced piece never took X's turn, so undoing it leaves it alone.
+  if _, piece := game.CurrentPlayer(); piece != X {
+    t.Fatalf("turn %s after undoing a forced piece, want X", piece)
+  }
+}
+
+func TestForceMoveRejectsInvalidPlacements(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  if err := game.ForceMove(X, 1, 1); !errors.Is(err, ErrCellOccupied) {
+    t.Errorf("occupied cell: got %v", err)
+  }
+  if err := game.ForceMove(X, 3, 0); !errors.Is(err, ErrOutOfRange) {
+    t.Errorf("off the board: got %v", err)
+  }
+  if err := game.ForceMove(T, 0, 0); err == nil {
+    t.Errorf("piece without a player: got no error")
+  }
+  if got := game.History(); len(got) != 1 {
+    t.Errorf("rejected placements recorded: %v", got)
+  }
+}
+
+func TestRematchKeepsSettings(t *testing.T) {
+  userA, userB := testUsers(t)
+  prev, err := StartGameWinLength(userA, userB, 5, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  prev.mode = Misere
+  corners := func(b Board, last Move) (Piece, bool) {
+    return B, false
+  }
+  prev.conditions = []WinCondition{corners}
+
+  game, err := Rematch(userA, userB)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if game.size != 5 || game.winLength != 4 || game.mode != Misere {
+    t.Fatalf("rematch size %d, win length %d, mode %d", game.size,
+      game.winLength, game.mode)
+  }
+  if len(game.conditions) != 1 {
+    t.Fatalf("rematch has %d win conditions, want 1", len(game.conditions))
+  }
+  // Nobody won, so the player who moved second goes first.
+  if user, _ := game.CurrentPlayer(); user != userB {
+    t.Fatalf("rematch starts with %s, want %s", user, userB)
+  }
+}
+
+func TestRematchAfterGameIsReleased(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("finished game still stored")
+  }
+
+  rematch, err := Rematch(userA, userB)
+  if err != nil {
+    t.Fatalf("Rematch after a released game: %v", err)
+  }
+  // O won, so X's player moves first.
+  if user, _ := rematch.CurrentPlayer(); user != userB {
+    t.Fatalf("rematch starts with %s, want the loser %s", user, userB)
+  }
+}
+
+func TestGameReleasedAfterLastCallback(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  found := false
+  game.OnMove(func(g *GameState, m Move, result GameResult) {
+    if result != Pending {
+      stored, ok := GetGame(userA, userB)
+      found = ok && stored == g
+    }
+  })
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  if !found {
+    t.Fatal("game released before the last move's callback")
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("finished game still stored")
+  }
+}
+
+func TestRejectedMoveDoesNotReleaseFinishedGame(t *testing.T) {
+  SetRetainFinishedGames(true)
+  defer SetRetainFinishedGames(false)
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+
+  SetRetainFinishedGames(false)
+  if err, _ := makeMove(game, userB, 2, 2); !errors.Is(err, ErrGameOver) {
+    t.Fatalf("move on a finished game got %v, want ErrGameOver", err)
+  }
+  if stored, ok := GetGame(userA, userB); !ok || stored != game {
+    t.Fatal("rejected move released the finished game")
+  }
+}
+
+func TestRematchAfterClear(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  game.Forfeit(userA)
+  ClearGamesForUser(userA)
+
+  if _, err := Rematch(userA, userB); err == nil {
+    t.Fatal("Rematch after clearing the users' games succeeded")
+  }
+}
+
+func TestMakeMoveContextReportsGameOverFirst(t *testing.T) {
+  game := startTestGame(t)
+  userA, _ := testUsers(t)
+  game.Forfeit(userA)
+
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+  err, result := MakeMoveContext(ctx, game, userA, 0, 0)
+  if !errors.Is(err, ErrGameOver) {
+    t.Fatalf("got %v, want ErrGameOver", err)
+  }
+  if result != XWin {
+    t.Fatalf("result %s, want X to win", result)
+  }
+}
+
+func TestMakeMoveContextCancelled(t *testing.T) {
+  game := startTestGame(t)
+  userA, _ := testUsers(t)
+
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+  if err, _ := MakeMoveContext(ctx, game, userA, 0, 0); !errors.Is(err,
+      context.Canceled) {
+    t.Fatalf("got %v, want context.Canceled", err)
+  }
+  if p, _ := game.Cell(0, 0); p != B {
+    t.Fatalf("cancelled move placed %s", p)
+  }
+}
+
+func TestResetRefusesStoredGame(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  if err := game.Reset(userA + "2", userB + "2"); err == nil {
+    t.Fatal("Reset of a stored game succeeded")
+  }
+  if stored, ok := GetGame(userA, userB); !ok || stored != game {
+    t.Fatal("refused Reset unstored the game")
+  }
+  if got := game.History(); len(got) != 1 {
+    t.Fatalf("refused Reset changed the history to %v", got)
+  }
+}
+
+func TestResetClosesSubscribers(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    t.Fatal(err)
+  }
+  moves := game.Subscribe()
+  playMoves(t, game, [2]int{1, 1})
+
+  if err := game.Reset(userB, userA); err != nil {
+    t.Fatal(err)
+  }
+  if m, ok := <-moves; !ok || m != (Move{Piece: O, X: 1, Y: 1}) {
+    t.Fatalf("got %v, %t, want the move made before Reset", m, ok)
+  }
+  if _, ok := <-moves; ok {
+    t.Fatal("subscriber channel still open after Reset")
+  }
+}
+
+func TestResetRecyclesReleasedGame(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  game.Forfeit(userA)
+
+  if err := game.Reset(userA + "2", userB + "2"); err != nil {
+    t.Fatal(err)
+  }
+  // The recycled game must not be mistaken for the old pair's last game.
+  if _, err := Rematch(userA, userB); err == nil {
+    t.Fatal("Rematch followed a game that was reset")
+  }
+}
+
+func TestResetFinishedGameInPlace(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  game.SetMeta("room", "1")
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  row := &game.board[0][0]
+
+  if err := game.Reset(userB, userA); err != nil {
+    t.Fatal(err)
+  }
+  if &game.board[0][0] != row {
+    t.Fatal("Reset reallocated the board")
+  }
+  fresh, err := newGame(userB, userA, boardSize)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if diffs := Diff(game, fresh); len(diffs) != 0 {
+    t.Fatalf("reset game differs from a new one: %v", diffs)
+  }
+  if len(game.history) != 0 || len(game.winningLine) != 0 ||
+      game.winLines != 0 {
+    t.Fatal("Reset left the previous game's history or winning line")
+  }
+  if _, ok := game.GetMeta("room"); ok {
+    t.Fatal("Reset kept the previous game's metadata")
+  }
+  if user, piece := game.CurrentPlayer(); user != userB || piece != O {
+    t.Fatalf("%s (%s) to move, want %s (%s)", user, piece, userB, O)
+  }
+  playMoves(t, game, [2]int{1, 1})
+}
+
+func TestApplyMovesEmptyBatchOnFinishedGame(t *testing.T) {
+  SetRetainFinishedGames(true)
+  defer SetRetainFinishedGames(false)
+  game := startTestGame(t)
+  userA, _ := testUsers(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+
+  for i := 0; i < 2; i++ {
+    if err := game.ApplyMoves(nil); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if stats := GetStats(userA); stats.Wins != 1 {
+    t.Fatalf("stats %+v after empty batches, want the single win", stats)
+  }
+}
+
+func TestApplyMovesAllOrNothing(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  before := game.Clone()
+
+  err := game.ApplyMoves([]UserMove{{userA, 1, 1}, {userB, 0, 0},
+    {userB, 2, 2}})
+  if !errors.Is(err, ErrNotYourTurn) {
+    t.Fatalf("got %v, want ErrNotYourTurn", err)
+  }
+  if diffs := Diff(game, before); len(diffs) != 0 {
+    t.Fatalf("failed batch changed the game: %v", diffs)
+  }
+
+  if err := game.ApplyMoves([]UserMove{{userA, 1, 1}, {userB, 0, 0}});
+      err != nil {
+    t.Fatal(err)
+  }
+  if got := game.History(); len(got) != 2 {
+    t.Fatalf("history %v, want both moves", got)
+  }
+}
+
+func TestUndoWinningMoveReversesStats(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  win := [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}}
+  playMoves(t, game, win...)
+
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if stats := GetStats(userA); stats != (Stats{}) {
+    t.Fatalf("winner stats %+v after undoing the win", stats)
+  }
+  if stats := GetStats(userB); stats != (Stats{}) {
+    t.Fatalf("loser stats %+v after undoing the win", stats)
+  }
+  if stored, ok := GetGame(userA, userB); !ok || stored != game {
+    t.Fatal("undone game not stored again")
+  }
+
+  playMoves(t, game, win[4])
+  if stats := GetStats(userA); stats != (Stats{Wins: 1}) {
+    t.Fatalf("winner stats %+v after winning again, want 1 win", stats)
+  }
+}
+
+func TestUndoDoesNotRestoreClearedGame(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  if err := clearGame(userA, userB); err != nil {
+    t.Fatal(err)
+  }
+
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if stored, ok := GetGame(userA, userB); ok {
+    t.Fatalf("undoing a cleared game stored %p", stored)
+  }
+}
+
+func TestUndoRefusesGamesNotEndedByMove(t *testing.T) {
+  userA, userB := testUsers(t)
+  for name, end := range map[string]func(g *GameState){
+    "forfeit": func(g *GameState) { g.Forfeit(userB) },
+    "draw": func(g *GameState) {
+      g.OfferDraw(userB)
+      g.AcceptDraw(userA)
+    },
+    "timeout": func(g *GameState) {
+      g.SetClock(time.Second)
+      MakeTimedMove(g, userB, 2, 2, 2 * time.Second)
+    },
+  } {
+    game := startTestGame(t)
+    playMoves(t, game, [2]int{1, 1})
+    end(game)
+    if game.Result() == Pending {
+      t.Fatalf("%s: game still pending", name)
+    }
+    before := GetStats(userA)
+
+    if err := game.Undo(); err == nil {
+      t.Errorf("%s: Undo succeeded", name)
+    }
+    if got := game.History(); len(got) != 1 {
+      t.Errorf("%s: refused Undo changed the history to %v", name, got)
+    }
+    if stats := GetStats(userA); stats != before {
+      t.Errorf("%s: refused Undo changed stats to %+v", name, stats)
+    }
+  }
+}
+
+func TestGetDiag(t *testing.T) {
+  for _, c := range []struct {
+    x, y int
+    main, anti bool
+  }{
+    {0, 0, true, false},
+    {1, 1, true, true},
+    {2, 2, true, false},
+    {0, 2, false, true},
+    {2, 0, false, true},
+    {0, 1, false, false},
+    {1, 2, false, false},
+  } {
+    if main, anti := getDiag(c.x, c.y, 3); main != c.main || anti != c.anti {
+      t.Errorf("getDiag(%d, %d) = %t, %t, want %t, %t", c.x, c.y, main, anti,
+        c.main, c.anti)
+    }
+  }
+}
+
+func TestWinOnMainDiagonal(t *testing.T) {
+  game := startTestGame(t)
+  result := playMoves(t, game, [2]int{1, 1}, [2]int{0, 1}, [2]int{0, 0},
+    [2]int{0, 2}, [2]int{2, 2})
+  if result != OWin {
+    t.Fatalf("result %s, want O to win", result)
+  }
+}
+
+func TestWinOnAntiDiagonal(t *testing.T) {
+  game := startTestGame(t)
+  result := playMoves(t, game, [2]int{0, 2}, [2]int{0, 0}, [2]int{1, 1},
+    [2]int{1, 0}, [2]int{2, 0})
+  if result != OWin {
+    t.Fatalf("result %s, want O to win", result)
+  }
+}
+
+func TestCenterCountsOnBothDiagonals(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  if diags := game.counts[O].diags; diags != [2]int{1, 1} {
+    t.Fatalf("diagonal counts %v after taking the center, want [1 1]", diags)
+  }
+}
+
+func TestXWinsByColumn(t *testing.T) {
+  game := startTestGame(t)
+  result := playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{2, 2},
+    [2]int{1, 1}, [2]int{1, 2})
+  if result != Pending {
+    t.Fatalf("result %s before X filled the column", result)
+  }
+  if result := playMoves(t, game, [2]int{2, 1}); result != XWin {
+    t.Fatalf("result %s, want X to win", result)
+  }
+  want := [][2]int{{0, 1}, {1, 1}, {2, 1}}
+  if line := game.WinningLine(); !reflect.DeepEqual(line, want) {
+    t.Fatalf("winning line %v, want column %v", line, want)
+  }
+}
+
+func TestFullBoardWithoutWinnerIsTie(t *testing.T) {
+  game := startTestGame(t)
+  result := playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{0, 2},
+    [2]int{2, 0}, [2]int{1, 0}, [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 1},
+    [2]int{2, 2})
+  if result != Tie {
+    t.Fatalf("result %s, want a tie", result)
+  }
+  if game.totalPieces != 9 {
+    t.Fatalf("total pieces %d, want 9", game.totalPieces)
+  }
+}
+
+func TestWinOnLastCellIsNotTie(t *testing.T) {
+  game := startTestGame(t)
+  result := playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{0, 2},
+    [2]int{1, 0}, [2]int{1, 1}, [2]int{1, 2}, [2]int{2, 1}, [2]int{2, 0},
+    [2]int{2, 2})
+  if result != OWin {
+    t.Fatalf("result %s filling the board with a win, want O to win", result)
+  }
+}
+
+func TestStartGameThenMove(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := startGame(userA, userB)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err, result := makeMove(game, userA, 0, 0)
+  if err != nil || result != Pending {
+    t.Fatalf("first move: %v, %s", err, result)
+  }
+  if user, piece := game.CurrentPlayer(); user != userB || piece != X {
+    t.Fatalf("after the first move, %s (%s) to move", user, piece)
+  }
+}
+
+func TestPlayersAlternateTurns(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+
+  if err, _ := makeMove(game, userB, 0, 0); !errors.Is(err, ErrNotYourTurn) {
+    t.Fatalf("X moving first: got %v, want ErrNotYourTurn", err)
+  }
+  for i, m := range []struct {
+    user string
+    piece Piece
+    x, y int
+  }{
+    {userA, O, 0, 0},
+    {userB, X, 1, 1},
+  } {
+    if user, piece := game.CurrentPlayer(); user != m.user || piece != m.piece {
+      t.Fatalf("move %d: %s (%s) to move, want %s (%s)", i + 1, user, piece,
+        m.user, m.piece)
+    }
+    if err, _ := makeMove(game, m.user, m.x, m.y); err != nil {
+      t.Fatalf("move %d: %v", i + 1, err)
+    }
+  }
+  if user, _ := game.CurrentPlayer(); user != userA {
+    t.Fatalf("%s to move after both players moved, want %s", user, userA)
+  }
+}
+
+func TestMoveMutatesBoardCell(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{2, 1})
+  if p, err := game.Cell(2, 1); err != nil || p != O {
+    t.Fatalf("Cell(2, 1) = %s, %v, want O", p, err)
+  }
+  if p, _ := game.Cell(1, 2); p != B {
+    t.Fatalf("Cell(1, 2) = %s, want it left blank", p)
+  }
+  if err, _ := makeMove(game, currPlayer(game), 2, 1); !errors.Is(err,
+      ErrCellOccupied) {
+    t.Fatalf("move on the piece: got %v, want ErrCellOccupied", err)
+  }
+}
+
+func TestGetGame(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+
+  if got, ok := GetGame(userA, userB); !ok || got != game {
+    t.Fatalf("GetGame(%s, %s) = %p, %t, want the started game", userA, userB,
+      got, ok)
+  }
+  if got, ok := GetGame(userB, userA); !ok || got != game {
+    t.Fatalf("GetGame with the users swapped = %p, %t", got, ok)
+  }
+  if got, ok := GetGame(userA, userA + "/missing"); ok || got != nil {
+    t.Fatalf("GetGame for users without a game = %p, %t", got, ok)
+  }
+}
+
+func TestConcurrentStartMoveAndClear(t *testing.T) {
+  name := testName(t)
+  var wg sync.WaitGroup
+  for i := 0; i < 8; i++ {
+    wg.Add(1)
+    go func(i int) {
+      defer wg.Done()
+      userA, userB := fmt.Sprintf("%s/%d/a", name, i),
+        fmt.Sprintf("%s/%d/b", name, i)
+      for round := 0; round < 20; round++ {
+        game, err := startGame(userA, userB)
+        if err != nil {
+          t.Error(err)
+          return
+        }
+        makeMove(game, userA, round % 3, round / 3 % 3)
+        if got, ok := GetGame(userB, userA); ok && got.Size() != boardSize {
+          t.Errorf("stored game has size %d", got.Size())
+        }
+        clearGame(userA, userB)
+      }
+      if _, ok := GetGame(userA, userB); ok {
+        t.Errorf("pair %d still has a game after clearGame", i)
+      }
+    }(i)
+  }
+  wg.Wait()
+}
+
+func TestFourByFourWin(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWithSize(userA, userB, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  result := playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1},
+    [2]int{1, 1}, [2]int{0, 2}, [2]int{1, 2})
+  if result != Pending {
+    t.Fatalf("result %s with three in a row on a 4x4 board", result)
+  }
+  if result := playMoves(t, game, [2]int{0, 3}); result != OWin {
+    t.Fatalf("result %s, want O to win", result)
+  }
+  if line := game.WinningLine(); len(line) != 4 {
+    t.Fatalf("winning line %v, want 4 cells", line)
+  }
+}
+
+func TestFiveByFiveTie(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWithSize(userA, userB, 5)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // Pairs of columns alternate between the players, so no line fills up.
+  var oCells, xCells [][2]int
+  for i := 0; i < 5; i++ {
+    for j := 0; j < 5; j++ {
+      if (i + j / 2) % 2 == 0 {
+        oCells = append(oCells, [2]int{i, j})
+      } else {
+        xCells = append(xCells, [2]int{i, j})
+      }
+    }
+  }
+  var moves [][2]int
+  for i, cell := range oCells {
+    moves = append(moves, cell)
+    if i < len(xCells) {
+      moves = append(moves, xCells[i])
+    }
+  }
+  if result := playMoves(t, game, moves...); result != Tie {
+    t.Fatalf("result %s, want a tie", result)
+  }
+}
+
+func TestStartGameWithSizeTooSmall(t *testing.T) {
+  userA, userB := testUsers(t)
+  if _, err := StartGameWithSize(userA, userB, minBoardSize - 1); err == nil {
+    t.Fatal("started a game smaller than minBoardSize")
+  }
+}
+
+func TestHistoryRecordsMovesInOrder(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{2, 2}, [2]int{0, 2},
+    [2]int{0, 1})
+
+  want := []Move{{Piece: O, X: 1, Y: 1}, {Piece: X, X: 0, Y: 0},
+    {Piece: O, X: 2, Y: 2}, {Piece: X, X: 0, Y: 2}, {Piece: O, X: 0, Y: 1}}
+  got := game.History()
+  if !reflect.DeepEqual(got, want) {
+    t.Fatalf("history %v, want %v", got, want)
+  }
+  got[0].X = 2
+  if game.History()[0] != want[0] {
+    t.Fatal("History returned the game's own slice")
+  }
+}
+
+func TestUndoRestoresState(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0})
+  before := game.Clone()
+
+  playMoves(t, game, [2]int{0, 2})
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if got := game.Clone(); !reflect.DeepEqual(got, before) {
+    t.Fatalf("state after Undo:\n%+v\nwant\n%+v", got, before)
+  }
+  if user, piece := game.CurrentPlayer(); user != currPlayer(before) ||
+      piece != O {
+    t.Fatalf("%s (%s) to move after Undo", user, piece)
+  }
+}
+
+func TestUndoWithoutMoves(t *testing.T) {
+  game := startTestGame(t)
+  if err := game.Undo(); err == nil {
+    t.Fatal("Undo with no moves played succeeded")
+  }
+}
+
+func TestMoveErrorSentinels(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  for _, c := range []struct {
+    name string
+    user string
+    x, y int
+    want error
+  }{
+    {"out of turn", userA, 0, 0, ErrNotYourTurn},
+    {"not a player", userA + "/other", 0, 0, ErrNotYourTurn},
+    {"negative", userB, -1, 0, ErrOutOfRange},
+    {"past the edge", userB, 0, 3, ErrOutOfRange},
+    {"occupied", userB, 1, 1, ErrCellOccupied},
+  } {
+    err, _ := makeMove(game, c.user, c.x, c.y)
+    if !errors.Is(err, c.want) {
+      t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+    }
+  }
+}
+
+func TestGetValidMoves(t *testing.T) {
+  game := startTestGame(t)
+  if moves := game.GetValidMoves(); len(moves) != 9 ||
+      moves[0] != [2]int{0, 0} || moves[8] != [2]int{2, 2} {
+    t.Fatalf("empty board moves %v, want every cell in row-major order",
+      moves)
+  }
+
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0})
+  want := [][2]int{{0, 1}, {0, 2}, {1, 0}, {1, 2}, {2, 0}, {2, 1}, {2, 2}}
+  if moves := game.GetValidMoves(); !reflect.DeepEqual(moves, want) {
+    t.Fatalf("moves %v, want %v", moves, want)
+  }
+
+  playMoves(t, game, [2]int{0, 2}, [2]int{2, 0}, [2]int{1, 0}, [2]int{1, 2},
+    [2]int{0, 1}, [2]int{2, 1}, [2]int{2, 2})
+  if moves := game.GetValidMoves(); moves == nil || len(moves) != 0 {
+    t.Fatalf("full board moves %#v, want an empty slice", moves)
+  }
+}
+
+func TestWatchGameSnapshotIsIndependent(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  snap, err := WatchGame(userB, userA)
+  if err != nil {
+    t.Fatal(err)
+  }
+  snap.board[0][0] = X
+  snap.counts[X].rows[0]++
+  snap.history = append(snap.history, Move{Piece: X})
+  if err, _ := makeMove(snap, userB, 2, 2); err != nil {
+    t.Fatal(err)
+  }
+
+  if p, _ := game.Cell(0, 0); p != B {
+    t.Fatal("changing the snapshot's board changed the game")
+  }
+  if p, _ := game.Cell(2, 2); p != B {
+    t.Fatal("a move on the snapshot changed the game")
+  }
+  if game.counts[X].rows[0] != 0 || len(game.History()) != 1 {
+    t.Fatal("changing the snapshot's counts or history changed the game")
+  }
+}
+
+func TestWatchGameMissing(t *testing.T) {
+  userA, userB := testUsers(t)
+  if _, err := WatchGame(userA, userB); err == nil {
+    t.Fatal("watched a game that does not exist")
+  }
+}
+
+func TestStartGameFirstPlayer(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, first := range []string{userA, userB} {
+    game, err := StartGameFirstPlayer(userA, userB, first)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if user, piece := game.CurrentPlayer(); user != first || piece != O {
+      t.Errorf("first player %s: %s (%s) to move", first, user, piece)
+    }
+    if got := pieceOwner(game, X); got == first {
+      t.Errorf("first player %s also holds X", first)
+    }
+  }
+
+  if _, err := StartGameFirstPlayer(userA, userB, userA + "/other");
+      err == nil {
+    t.Fatal("started a game with a first player not in it")
+  }
+}
+
+func TestMoveAfterWinRejected(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  before := game.Clone()
+
+  user, _ := game.CurrentPlayer()
+  for _, u := range []string{user, currPlayer(game) + "/other"} {
+    err, result := makeMove(game, u, 2, 2)
+    if !errors.Is(err, ErrGameOver) || result != OWin {
+      t.Fatalf("move after the win: got %v, %s, want ErrGameOver", err,
+        result)
+    }
+  }
+  if diffs := Diff(game, before); len(diffs) != 0 {
+    t.Fatalf("rejected move changed the game: %v", diffs)
+  }
+}
+
+func TestMisereLineMakerLoses(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  result := playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1},
+    [2]int{1, 1}, [2]int{0, 2})
+  if result != XWin {
+    t.Fatalf("result %s after O completed a row, want X to win", result)
+  }
+  if winner, _ := game.WinnerUser(); winner != userB {
+    t.Fatalf("winner %s, want %s", winner, userB)
+  }
+}
+
+func TestMisereTie(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  result := playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{0, 2},
+    [2]int{2, 0}, [2]int{1, 0}, [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 1},
+    [2]int{2, 2})
+  if result != Tie {
+    t.Fatalf("result %s, want a tie", result)
+  }
+}
+
+func TestMakeMoveContextDeadline(t *testing.T) {
+  game := startTestGame(t)
+  userA, _ := testUsers(t)
+
+  ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+  defer cancel()
+  if err, result := MakeMoveContext(ctx, game, userA, 0, 0); !errors.Is(err,
+      context.DeadlineExceeded) || result != Pending {
+    t.Fatalf("got %v, %s, want context.DeadlineExceeded", err, result)
+  }
+  if err, _ := MakeMoveContext(context.Background(), game, userA, 0,
+      0); err != nil {
+    t.Fatalf("move with a live context: %v", err)
+  }
+}
+
+func TestForfeitDeclaresOpponentWinner(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, c := range []struct {
+    loser string
+    want GameResult
+    winner string
+  }{
+    {userA, XWin, userB},
+    {userB, OWin, userA},
+  } {
+    game := startTestGame(t)
+    playMoves(t, game, [2]int{1, 1})
+    if result := game.Forfeit(c.loser); result != c.want {
+      t.Errorf("%s forfeiting: result %s, want %s", c.loser, result, c.want)
+    }
+    if winner, _ := game.WinnerUser(); winner != c.winner {
+      t.Errorf("%s forfeiting: winner %s, want %s", c.loser, winner,
+        c.winner)
+    }
+  }
+}
+
+func TestForfeitByNonPlayer(t *testing.T) {
+  game := startTestGame(t)
+  if result := game.Forfeit(testName(t) + "/other"); result != Pending {
+    t.Fatalf("forfeit by a non-player: result %s", result)
+  }
+}
+
+func TestSizeAndCell(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWithSize(userA, userB, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{3, 0})
+
+  if size := game.Size(); size != 4 {
+    t.Fatalf("Size() = %d, want 4", size)
+  }
+  if p, err := game.Cell(3, 0); err != nil || p != O {
+    t.Fatalf("Cell(3, 0) = %s, %v, want O", p, err)
+  }
+  if p, err := game.Cell(0, 3); err != nil || p != B {
+    t.Fatalf("Cell(0, 3) = %s, %v, want B", p, err)
+  }
+  for _, pos := range [][2]int{{-1, 0}, {0, -1}, {4, 0}, {0, 4}} {
+    if _, err := game.Cell(pos[0], pos[1]); !errors.Is(err, ErrOutOfRange) {
+      t.Errorf("Cell(%d, %d): got %v, want ErrOutOfRange", pos[0], pos[1],
+        err)
+    }
+  }
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  before := game.Clone()
+
+  clone := game.Clone()
+  if err, _ := applyMove(clone, currPlayer(clone), 0, 0); err != nil {
+    t.Fatal(err)
+  }
+  clone.board[2][2] = O
+  clone.players[O] = "someone else"
+
+  if got := game.Clone(); !reflect.DeepEqual(got, before) {
+    t.Fatalf("changing the clone changed the game:\n%+v\nwant\n%+v", got,
+      before)
+  }
+}
+
+func TestFinishingCloneLeavesGameAlone(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1})
+  userA, userB := game.players[O], game.players[X]
+
+  clone := game.Clone()
+  if result := playMoves(t, clone, [2]int{0, 2}); result != OWin {
+    t.Fatalf("clone result %s, want %s", result, OWin)
+  }
+  if stats := GetStats(userA); stats != (Stats{}) {
+    t.Fatalf("finishing the clone recorded %+v", stats)
+  }
+  if got, ok := GetGame(userA, userB); !ok || got != game {
+    t.Fatal("finishing the clone released the game")
+  }
+
+  clearGame(userA, userB)
+  if err := clone.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if got, ok := GetGame(userA, userB); ok {
+    t.Fatalf("undoing the clone stored %p", got)
+  }
+}
+
+func TestWinningLineCells(t *testing.T) {
+  for _, c := range []struct {
+    name string
+    moves [][2]int
+    want [][2]int
+  }{
+    {"row", [][2]int{{1, 0}, {0, 0}, {1, 1}, {0, 1}, {1, 2}},
+      [][2]int{{1, 0}, {1, 1}, {1, 2}}},
+    {"column", [][2]int{{0, 2}, {0, 0}, {1, 2}, {0, 1}, {2, 2}},
+      [][2]int{{0, 2}, {1, 2}, {2, 2}}},
+    {"main diagonal", [][2]int{{0, 0}, {0, 1}, {1, 1}, {0, 2}, {2, 2}},
+      [][2]int{{0, 0}, {1, 1}, {2, 2}}},
+    {"anti-diagonal", [][2]int{{0, 2}, {0, 0}, {1, 1}, {0, 1}, {2, 0}},
+      [][2]int{{0, 2}, {1, 1}, {2, 0}}},
+  } {
+    game := startTestGame(t)
+    if result := playMoves(t, game, c.moves...); result != OWin {
+      t.Fatalf("%s: result %s, want O to win", c.name, result)
+    }
+    if line := game.WinningLine(); !reflect.DeepEqual(line, c.want) {
+      t.Errorf("%s: winning line %v, want %v", c.name, line, c.want)
+    }
+  }
+}
+
+func TestWinningLineWhilePending(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  if line := game.WinningLine(); line != nil {
+    t.Fatalf("winning line %v before anyone won", line)
+  }
+}
+
+func TestOnMoveCallbacksInOrder(t *testing.T) {
+  game := startTestGame(t)
+  var calls []string
+  record := func(name string) MoveCallback {
+    return func(g *GameState, m Move, result GameResult) {
+      if g != game {
+        t.Errorf("%s called with another game", name)
+      }
+      calls = append(calls, fmt.Sprintf("%s %s %d %d %s", name, m.Piece, m.X,
+        m.Y, result))
+    }
+  }
+  game.OnMove(record("first"))
+  game.OnMove(record("second"))
+
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1})
+  makeMove(game, currPlayer(game), 1, 1)
+  playMoves(t, game, [2]int{0, 2})
+
+  want := []string{
+    "first O 0 0 Pending", "second O 0 0 Pending",
+    "first X 1 0 Pending", "second X 1 0 Pending",
+    "first O 0 1 Pending", "second O 0 1 Pending",
+    "first X 1 1 Pending", "second X 1 1 Pending",
+    "first O 0 2 O wins", "second O 0 2 O wins",
+  }
+  if !reflect.DeepEqual(calls, want) {
+    t.Fatalf("callbacks got\n%v\nwant\n%v", calls, want)
+  }
+}
+
+func TestUserPairKeyOrder(t *testing.T) {
+  if a, b := getUserPairKey("alice", "bob"), getUserPairKey("bob",
+      "alice"); a != b {
+    t.Fatalf("keys %q and %q differ by argument order", a, b)
+  }
+  if key := getUserPairKey("bob", "alice"); key != "5:alice|3:bob" {
+    t.Fatalf("key %q, want the users in sorted order", key)
+  }
+}
+
+func TestUserPairKeyAdversarialNames(t *testing.T) {
+  pairs := [][2]string{
+    {"a$$b", "c"},
+    {"a", "b$$c"},
+    {"a|1:b", "c"},
+    {"a", "1:b|c"},
+    {"3:a|b", "c"},
+    {"a", "b"},
+    {"a|", "b"},
+    {"a", "|b"},
+  }
+  seen := map[string][2]string{}
+  for _, p := range pairs {
+    key := getUserPairKey(p[0], p[1])
+    if other, ok := seen[key]; ok {
+      t.Errorf("pairs %q and %q share key %q", other, p, key)
+    }
+    seen[key] = p
+    if users, ok := parseUsersKey(key); !ok || len(users) != 2 {
+      t.Errorf("key %q does not parse back into two users", key)
+    }
+  }
+}
+
+func TestForceMoveSetsUpPuzzle(t *testing.T) {
+  game := startTestGame(t)
+  for _, m := range []Move{{Piece: X, X: 0, Y: 0}, {Piece: X, X: 1, Y: 1},
+      {Piece: O, X: 2, Y: 0}} {
+    if err := game.ForceMove(m.Piece, m.X, m.Y); err != nil {
+      t.Fatal(err)
+    }
+  }
+  // Forced pieces leave the turn with O.
+  if _, piece := game.CurrentPlayer(); piece != O {
+    t.Fatalf("%s to move after forced pieces, want O", piece)
+  }
+  if result := game.Result(); result != Pending {
+    t.Fatalf("result %s before any line was completed", result)
+  }
+  if moves := game.WinningMoves(); len(moves) != 0 {
+    t.Fatalf("O has winning moves %v", moves)
+  }
+  if threats := game.Threats(X); len(threats) != 1 ||
+      threats[0] != [2]int{2, 2} {
+    t.Fatalf("X threats %v, want 2 2", threats)
+  }
+
+  if err := game.ForceMove(X, 2, 2); err != nil {
+    t.Fatal(err)
+  }
+  if result := game.Result(); result != XWin {
+    t.Fatalf("result %s after X's forced diagonal, want X to win", result)
+  }
+  if err := game.ForceMove(O, 0, 1); !errors.Is(err, ErrGameOver) {
+    t.Fatalf("ForceMove on a finished game: got %v", err)
+  }
+}
+
+func TestRematchFlipsFirstPlayer(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, c := range []struct {
+    name string
+    moves [][2]int
+    first string
+  }{
+    // X wins, so O's player lost and moves first again.
+    {"X wins", [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 2}, {1, 2}},
+      userA},
+    {"tie", [][2]int{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0}, {1, 2}, {0, 1},
+      {2, 1}, {2, 2}}, userB},
+  } {
+    game := startTestGame(t)
+    playMoves(t, game, c.moves...)
+    rematch, err := Rematch(userB, userA)
+    if err != nil {
+      t.Fatalf("%s: %v", c.name, err)
+    }
+    if user, _ := rematch.CurrentPlayer(); user != c.first {
+      t.Errorf("%s: rematch starts with %s, want %s", c.name, user, c.first)
+    }
+  }
+}
+
+func TestRematchWithoutPreviousGame(t *testing.T) {
+  userA, userB := testUsers(t)
+  if _, err := Rematch(userA, userB); err == nil {
+    t.Fatal("Rematch without a previous game succeeded")
+  }
+}
+
+func TestStartGameRejectsBadUsernames(t *testing.T) {
+  userA, _ := testUsers(t)
+  for _, users := range [][2]string{{"", userA}, {userA, ""}, {userA, userA},
+      {"", ""}} {
+    if _, err := startGame(users[0], users[1]); err == nil {
+      t.Errorf("startGame(%q, %q) succeeded", users[0], users[1])
+    }
+    if _, ok := GetGame(users[0], users[1]); ok {
+      t.Errorf("game stored for %q and %q", users[0], users[1])
+    }
+  }
+  if _, err := StartGameWithSize(userA, userA, 4); err == nil {
+    t.Error("StartGameWithSize let a user play themselves")
+  }
+  if _, err := StartGameMode("", userA, Misere); err == nil {
+    t.Error("StartGameMode accepted an empty username")
+  }
+}
+
+func TestGamesForUser(t *testing.T) {
+  name := testName(t)
+  user := name + "/user"
+  for _, opponent := range []string{"c", "a", "b"} {
+    if _, err := startGame(user, name + "/" + opponent); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  want := []string{name + "/a", name + "/b", name + "/c"}
+  if got := GamesForUser(user); !reflect.DeepEqual(got, want) {
+    t.Fatalf("GamesForUser = %v, want %v", got, want)
+  }
+  if got := GamesForUser(name + "/nobody"); got == nil || len(got) != 0 {
+    t.Fatalf("GamesForUser for a user without games = %#v", got)
+  }
+}
+
+func TestGetDiagAcrossSizes(t *testing.T) {
+  for _, size := range []int{3, 4, 5} {
+    mains, antis := 0, 0
+    for x := 0; x < size; x++ {
+      for y := 0; y < size; y++ {
+        main, anti := getDiag(x, y, size)
+        if main != (x == y) || anti != (x + y == size - 1) {
+          t.Errorf("size %d: getDiag(%d, %d) = %t, %t", size, x, y, main,
+            anti)
+        }
+        if main {
+          mains++
+        }
+        if anti {
+          antis++
+        }
+      }
+    }
+    if mains != size || antis != size {
+      t.Errorf("size %d: %d main and %d anti diagonal cells, want %d each",
+        size, mains, antis, size)
+    }
+  }
+}
+
+func TestResultPendingThenTerminal(t *testing.T) {
+  game := startTestGame(t)
+  if result := game.Result(); result != Pending {
+    t.Fatalf("fresh game result %s, want %s", result, Pending)
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1})
+  if result := game.Result(); result != Pending {
+    t.Fatalf("mid-game result %s, want %s", result, Pending)
+  }
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 2})
+  if result := game.Result(); result != OWin {
+    t.Fatalf("finished game result %s, want %s", result, OWin)
+  }
+}
+
+func TestWinLengthFourOnFiveByFive(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWinLength(userA, userB, 5, 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // O lines up four on a diagonal off the main one, and X three in a row.
+  result := playMoves(t, game, [2]int{1, 0}, [2]int{0, 1}, [2]int{2, 1},
+    [2]int{0, 2}, [2]int{3, 2}, [2]int{0, 3})
+  if result != Pending {
+    t.Fatalf("result %s after three in a row, want %s", result, Pending)
+  }
+  if result := playMoves(t, game, [2]int{4, 3}); result != OWin {
+    t.Fatalf("result %s after four in a row, want %s", result, OWin)
+  }
+  want := [][2]int{{1, 0}, {2, 1}, {3, 2}, {4, 3}}
+  if line := game.WinningLine(); !reflect.DeepEqual(line, want) {
+    t.Fatalf("winning line %v, want %v", line, want)
+  }
+}
+
+func TestWinLengthOutOfRange(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, n := range []int{2, 6} {
+    if _, err := StartGameWinLength(userA, userB, 5, n); err == nil {
+      t.Errorf("win length %d on a 5x5 board was accepted", n)
+    }
+  }
+}
+
+func TestRemainingCells(t *testing.T) {
+  game := startTestGame(t)
+  if n := game.RemainingCells(); n != 9 {
+    t.Fatalf("%d cells left on an empty board, want 9", n)
+  }
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{0, 2})
+  if n := game.RemainingCells(); n != 6 {
+    t.Fatalf("%d cells left mid-game, want 6", n)
+  }
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if n := game.RemainingCells(); n != 7 {
+    t.Fatalf("%d cells left after Undo, want 7", n)
+  }
+  playMoves(t, game, [2]int{0, 2}, [2]int{2, 0}, [2]int{1, 0}, [2]int{1, 2},
+    [2]int{0, 1}, [2]int{2, 1}, [2]int{2, 2})
+  if n := game.RemainingCells(); n != 0 {
+    t.Fatalf("%d cells left on a full board, want 0", n)
+  }
+}
+
+func TestClearGamesForUser(t *testing.T) {
+  userA, userB := testUsers(t)
+  userC := testName(t) + "/c"
+  first, err := startGame(userA, userB)
+  if err != nil {
+    t.Fatal(err)
+  }
+  second, err := startGame(userC, userA)
+  if err != nil {
+    t.Fatal(err)
+  }
+  other, err := startGame(userB, userC)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if n := ClearGamesForUser(userA); n != 2 {
+    t.Fatalf("cleared %d games, want 2", n)
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("game against userB still stored")
+  }
+  if _, ok := GetGame(userC, userA); ok {
+    t.Fatal("game against userC still stored")
+  }
+  if game, ok := GetGame(userB, userC); !ok || game != other {
+    t.Fatal("game between the other players was cleared")
+  }
+  if winner, _ := first.WinnerUser(); winner != userB {
+    t.Fatalf("first game won by %q, want %q by forfeit", winner, userB)
+  }
+  if winner, _ := second.WinnerUser(); winner != userC {
+    t.Fatalf("second game won by %q, want %q by forfeit", winner, userC)
+  }
+  if n := ClearGamesForUser(userA); n != 0 {
+    t.Fatalf("cleared %d games the second time, want 0", n)
+  }
+}
+
+func TestValidateMove(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  before := game.Clone()
+
+  for _, c := range []struct {
+    user string
+    x, y int
+    want error
+  }{
+    {userA, 0, 0, ErrNotYourTurn},
+    {userB, 3, 0, ErrOutOfRange},
+    {userB, 0, -1, ErrOutOfRange},
+    {userB, 1, 1, ErrCellOccupied},
+    {userB, 0, 0, nil},
+  } {
+    if err := game.ValidateMove(c.user, c.x, c.y); !errors.Is(err, c.want) {
+      t.Errorf("ValidateMove(%s, %d, %d) = %v, want %v", c.user, c.x, c.y,
+        err, c.want)
+    }
+  }
+  if got := game.Clone(); !reflect.DeepEqual(got, before) {
+    t.Fatalf("ValidateMove changed the game:\n%+v\nwant\n%+v", got, before)
+  }
+
+  game.Pause()
+  if err := game.ValidateMove(userB, 0, 0); !errors.Is(err, ErrGamePaused) {
+    t.Fatalf("ValidateMove while paused = %v, want %v", err, ErrGamePaused)
+  }
+  game.Resume()
+
+  playMoves(t, game, [2]int{1, 0}, [2]int{0, 0}, [2]int{0, 2}, [2]int{2, 2})
+  if err := game.ValidateMove(userA, 2, 0); !errors.Is(err, ErrGameOver) {
+    t.Fatalf("ValidateMove after the game ended = %v, want %v", err,
+      ErrGameOver)
+  }
+}
+
+func TestEachCellInRowMajorOrder(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 1}, [2]int{1, 1}, [2]int{2, 0})
+
+  var got [][3]int
+  game.EachCell(func(x, y int, p Piece) {
+    got = append(got, [3]int{x, y, int(p)})
+  })
+  want := [][3]int{
+    {0, 0, int(B)}, {0, 1, int(O)}, {0, 2, int(B)},
+    {1, 0, int(B)}, {1, 1, int(X)}, {1, 2, int(B)},
+    {2, 0, int(O)}, {2, 1, int(B)}, {2, 2, int(B)},
+  }
+  if !reflect.DeepEqual(got, want) {
+    t.Fatalf("EachCell visited %v, want %v", got, want)
+  }
+}
+
+func TestWinLineCountDoubleLine(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 1}, [2]int{1, 1}, [2]int{0, 2}, [2]int{2, 1},
+    [2]int{1, 0}, [2]int{1, 2}, [2]int{2, 0}, [2]int{2, 2})
+  if n := game.WinLineCount(); n != 0 {
+    t.Fatalf("%d lines completed while pending, want 0", n)
+  }
+
+  // The corner completes both the first row and the first column.
+  if result := playMoves(t, game, [2]int{0, 0}); result != OWin {
+    t.Fatalf("result %s, want %s", result, OWin)
+  }
+  if n := game.WinLineCount(); n != 2 {
+    t.Fatalf("%d lines completed, want 2", n)
+  }
+}
+
+func TestWinLineCountSingleLine(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  if n := game.WinLineCount(); n != 1 {
+    t.Fatalf("%d lines completed, want 1", n)
+  }
+}
+
+func TestPauseBlocksMovesUntilResume(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  game.Pause()
+  if err, _ := makeMove(game, userA, 1, 1); !errors.Is(err, ErrGamePaused) {
+    t.Fatalf("move while paused = %v, want %v", err, ErrGamePaused)
+  }
+  if game.totalPieces != 0 {
+    t.Fatal("move while paused placed a piece")
+  }
+
+  game.Resume()
+  playMoves(t, game, [2]int{1, 1})
+}
+
+func TestPauseFinishedGameIsNoOp(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  game.Pause()
+  if game.paused {
+    t.Fatal("finished game was paused")
+  }
+}
+
+func TestWinnerUser(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, c := range []struct {
+    name string
+    moves [][2]int
+    winner string
+    won bool
+  }{
+    {"pending", [][2]int{{1, 1}, {0, 0}}, "", false},
+    {"O win", [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}}, userA, true},
+    {"X win", [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 2}, {1, 2}},
+      userB, true},
+    {"tie", [][2]int{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0}, {1, 2}, {0, 1},
+      {2, 1}, {2, 2}}, "", false},
+  } {
+    game, err := newGame(userA, userB, boardSize)
+    if err != nil {
+      t.Fatal(err)
+    }
+    playMoves(t, game, c.moves...)
+    if winner, won := game.WinnerUser(); winner != c.winner || won != c.won {
+      t.Errorf("%s: WinnerUser() = %q, %t, want %q, %t", c.name, winner, won,
+        c.winner, c.won)
+    }
+  }
+}
+
+func TestLastMove(t *testing.T) {
+  game := startTestGame(t)
+  if m, ok := game.LastMove(); ok {
+    t.Fatalf("fresh game has last move %+v", m)
+  }
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 2})
+  if m, ok := game.LastMove(); !ok || m != (Move{Piece: X, X: 0, Y: 2}) {
+    t.Fatalf("LastMove() = %+v, %t, want X at 0 2", m, ok)
+  }
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if m, ok := game.LastMove(); !ok || m != (Move{Piece: O, X: 1, Y: 1}) {
+    t.Fatalf("LastMove() after Undo = %+v, %t, want O at 1 1", m, ok)
+  }
+}
+
+func TestMultiplayerWinOnFiveByFive(t *testing.T) {
+  name := testName(t)
+  users := []string{name + "/a", name + "/b", name + "/c"}
+  game, err := StartMultiplayer(users, 5)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  // T fills the bottom row while O and X leave each other lines open.
+  moves := [][2]int{
+    {0, 0}, {1, 0}, {4, 0},
+    {0, 1}, {1, 1}, {4, 1},
+    {0, 2}, {1, 2}, {4, 2},
+    {2, 0}, {3, 0}, {4, 3},
+    {2, 2}, {3, 1}, {4, 4},
+  }
+  for i, m := range moves {
+    // Turns rotate through O, X, and T.
+    if user, p := game.CurrentPlayer(); user != users[i % 3] ||
+        p != Piece(i % 3) {
+      t.Fatalf("move %d: %s (%s) to move, want %s (%s)", i + 1, user, p,
+        users[i % 3], Piece(i % 3))
+    }
+    result := playMoves(t, game, m)
+    if i < len(moves) - 1 && result != Pending {
+      t.Fatalf("move %d ended the game with %s", i + 1, result)
+    }
+  }
+  if result := game.Result(); result != TWin {
+    t.Fatalf("result %s, want %s", result, TWin)
+  }
+  if winner, _ := game.WinnerUser(); winner != users[2] {
+    t.Fatalf("won by %q, want %q", winner, users[2])
+  }
+}
+
+func TestCurrentPlayerPairing(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  for i, c := range []struct {
+    user string
+    piece Piece
+  }{
+    {userA, O},
+    {userB, X},
+    {userA, O},
+  } {
+    if user, piece := game.CurrentPlayer(); user != c.user ||
+        piece != c.piece {
+      t.Fatalf("after %d moves: %s (%s) to move, want %s (%s)", i, user,
+        piece, c.user, c.piece)
+    }
+    playMoves(t, game, [2]int{i, i})
+  }
+}
+
+func TestFinishedGameIsCleanedUp(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1})
+  if _, ok := GetGame(userA, userB); !ok {
+    t.Fatal("game removed before it was over")
+  }
+  playMoves(t, game, [2]int{0, 2})
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("won game is still retrievable")
+  }
+}
+
+func TestForfeitedGameIsCleanedUp(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  game.Forfeit(userA)
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("forfeited game is still retrievable")
+  }
+}
+
+func TestRetainFinishedGames(t *testing.T) {
+  SetRetainFinishedGames(true)
+  defer SetRetainFinishedGames(false)
+
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  if got, ok := GetGame(userA, userB); !ok || got != game {
+    t.Fatal("finished game was not retained")
+  }
+}
+
+func TestStartGameIfAbsent(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, created := StartGameIfAbsent(userA, userB)
+  if !created || game == nil {
+    t.Fatal("no game created for a new pair")
+  }
+  playMoves(t, game, [2]int{1, 1})
+
+  // A stale request for a new game leaves the live one alone.
+  existing, created := StartGameIfAbsent(userB, userA)
+  if created || existing != game {
+    t.Fatal("live game was replaced")
+  }
+  if existing.totalPieces != 1 {
+    t.Fatalf("live game has %d pieces, want 1", existing.totalPieces)
+  }
+  if stored, _ := GetGame(userA, userB); stored != game {
+    t.Fatal("stored game changed")
+  }
+}
+
+func TestStartGameIfAbsentReplacesFinishedGame(t *testing.T) {
+  SetRetainFinishedGames(true)
+  defer SetRetainFinishedGames(false)
+
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  next, created := StartGameIfAbsent(userA, userB)
+  if !created || next == game {
+    t.Fatal("finished game was not replaced")
+  }
+  if _, created := StartGameIfAbsent(userA, ""); created {
+    t.Fatal("game created with an empty username")
+  }
+}
+
+func TestStartGameOnFreshPairDoesNotPanic(t *testing.T) {
+  userA, userB := testUsers(t)
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("game found before any was started")
+  }
+  if err := clearGame(userA, userB); err != nil {
+    t.Fatal(err)
+  }
+  game, err := startGame(userA, userB)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if stored, ok := GetGame(userA, userB); !ok || stored != game {
+    t.Fatal("started game was not stored")
+  }
+}
+
+func TestLookupsOnNilCurrentGames(t *testing.T) {
+  currentGamesMu.Lock()
+  saved := currentGames
+  currentGames = nil
+  currentGamesMu.Unlock()
+  defer func() {
+    currentGamesMu.Lock()
+    currentGames = saved
+    currentGamesMu.Unlock()
+  }()
+
+  userA, userB := testUsers(t)
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("game found in a nil map")
+  }
+  if err := clearGame(userA, userB); err != nil {
+    t.Fatal(err)
+  }
+  if games := GamesForUser(userA); len(games) != 0 {
+    t.Fatalf("GamesForUser found %v in a nil map", games)
+  }
+}
+
+func TestMoveErrorPrecedence(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  for _, c := range []struct {
+    name string
+    user string
+    x, y int
+    want error
+  }{
+    {"turn before bounds", userA, 5, 5, ErrNotYourTurn},
+    {"turn before occupancy", userA, 1, 1, ErrNotYourTurn},
+    {"bounds before occupancy", userB, 3, 1, ErrOutOfRange},
+  } {
+    if err, _ := makeMove(game, c.user, c.x, c.y); !errors.Is(err, c.want) {
+      t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+    }
+  }
+
+  // Once the board is full and the game over, nothing else is reported.
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 2}, [2]int{2, 0}, [2]int{1, 0},
+    [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 1}, [2]int{2, 2})
+  for _, c := range []struct {
+    name string
+    user string
+    x, y int
+  }{
+    {"out of turn", userA, 0, 0},
+    {"occupied", userB, 1, 1},
+    {"out of range", userB, -1, 9},
+    {"not a player", userA + "/other", 0, 0},
+  } {
+    if err, _ := makeMove(game, c.user, c.x, c.y); !errors.Is(err,
+        ErrGameOver) {
+      t.Errorf("%s on a finished game: got %v, want %v", c.name, err,
+        ErrGameOver)
+    }
+  }
+}
+
+// Wins for the player holding all four corners of the board.
+func fourCorners(b Board, last Move) (Piece, bool) {
+  n := len(b) - 1
+  p := b[0][0]
+  if p == B || b[0][n] != p || b[n][0] != p || b[n][n] != p {
+    return B, false
+  }
+  return p, true
+}
+
+func TestWinConditionFourCorners(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameWithConditions(userA, userB,
+    []WinCondition{fourCorners})
+  if err != nil {
+    t.Fatal(err)
+  }
+  moves := [][2]int{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {2, 0}, {1, 2}}
+  if result := playMoves(t, game, moves...); result != Pending {
+    t.Fatalf("result %s with three corners, want %s", result, Pending)
+  }
+  if result := playMoves(t, game, [2]int{2, 2}); result != OWin {
+    t.Fatalf("result %s with four corners, want %s", result, OWin)
+  }
+
+  // Without the condition the same moves keep the game going.
+  plain, err := newGame(userA, userB, boardSize)
+  if err != nil {
+    t.Fatal(err)
+  }
+  moves = append(moves, [2]int{2, 2})
+  if result := playMoves(t, plain, moves...); result != Pending {
+    t.Fatalf("result %s without the condition, want %s", result, Pending)
+  }
+}
+
+func TestMoveErrorCodes(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  check := func(name string, err error, code string) {
+    var moveErr *MoveError
+    if !errors.As(err, &moveErr) {
+      t.Errorf("%s: got %v, want a MoveError", name, err)
+      return
+    }
+    if moveErr.Code != code || moveErr.Message == "" {
+      t.Errorf("%s: code %q with message %q, want code %q", name,
+        moveErr.Code, moveErr.Message, code)
+    }
+  }
+  err, _ := makeMove(game, userA, 0, 0)
+  check("out of turn", err, "not_your_turn")
+  err, _ = makeMove(game, userB, 0, 3)
+  check("out of range", err, "out_of_range")
+  err, _ = makeMove(game, userB, 1, 1)
+  check("occupied", err, "occupied")
+
+  game.Pause()
+  err, _ = makeMove(game, userB, 0, 0)
+  check("paused", err, "game_paused")
+  game.Resume()
+
+  err, _ = MakeMoveCoord(game, userB, "9z")
+  check("malformed coordinate", err, "malformed_coordinate")
+  ctx, cancel := context.WithCancel(context.Background())
+  cancel()
+  err, _ = MakeMoveContext(ctx, game, userB, 0, 0)
+  check("cancelled", err, "cancelled")
+  ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+  defer cancel()
+  err, _ = MakeMoveContext(ctx, game, userB, 0, 0)
+  check("deadline exceeded", err, "deadline_exceeded")
+  check("forced unknown piece", game.ForceMove(T, 0, 0), "unknown_piece")
+  check("forced out of range", game.ForceMove(X, 3, 0), "out_of_range")
+  check("forced occupied", game.ForceMove(X, 1, 1), "occupied")
+
+  game.Forfeit(userB)
+  err, _ = makeMove(game, userA, 0, 0)
+  check("game over", err, "game_over")
+  check("forced game over", game.ForceMove(X, 0, 0), "game_over")
+}
+
+func TestCellInWinningLine(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 2}, [2]int{0, 0}, [2]int{1, 1}, [2]int{0, 1})
+  if game.CellInWinningLine(1, 1) {
+    t.Fatal("cell in a winning line before anyone won")
+  }
+
+  playMoves(t, game, [2]int{2, 0})
+  for x := 0; x < 3; x++ {
+    for y := 0; y < 3; y++ {
+      want := x + y == 2
+      if got := game.CellInWinningLine(x, y); got != want {
+        t.Errorf("CellInWinningLine(%d, %d) = %t, want %t", x, y, got, want)
+      }
+    }
+  }
+  if game.CellInWinningLine(-1, 3) {
+    t.Fatal("cell off the board in the winning line")
+  }
+}
+
+func TestMeta(t *testing.T) {
+  game := startTestGame(t)
+  if v, ok := game.GetMeta("room"); ok {
+    t.Fatalf("missing key has value %q", v)
+  }
+  game.SetMeta("room", "12")
+  game.SetMeta("round", "1")
+  game.SetMeta("round", "2")
+  if v, ok := game.GetMeta("room"); !ok || v != "12" {
+    t.Fatalf("GetMeta(room) = %q, %t, want 12", v, ok)
+  }
+  if v, ok := game.GetMeta("round"); !ok || v != "2" {
+    t.Fatalf("GetMeta(round) = %q, %t, want the later value 2", v, ok)
+  }
+  if v, ok := game.GetMeta("seat"); ok {
+    t.Fatalf("missing key has value %q", v)
+  }
+}
+
+func TestMakeMoveWithIDAppliesOnce(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  for i := 0; i < 2; i++ {
+    if err, result := game.MakeMoveWithID(userA, "m1", 1, 1); err != nil ||
+        result != Pending {
+      t.Fatalf("submission %d: %v, %s", i + 1, err, result)
+    }
+  }
+  if game.totalPieces != 1 || len(game.history) != 1 {
+    t.Fatalf("%d pieces after a retried move, want 1", game.totalPieces)
+  }
+  if user, _ := game.CurrentPlayer(); user != userB {
+    t.Fatalf("%s to move after a retried move, want %s", user, userB)
+  }
+
+  // A rejected move is not recorded, so it can be retried once legal.
+  if err, _ := game.MakeMoveWithID(userA, "m2", 0, 0); err == nil {
+    t.Fatal("out of turn move accepted")
+  }
+  if err, _ := game.MakeMoveWithID(userB, "m2", 0, 0); err != nil {
+    t.Fatal(err)
+  }
+  if game.totalPieces != 2 {
+    t.Fatalf("%d pieces, want 2", game.totalPieces)
+  }
+}
+
+func TestMakeMoveWithIDReturnsPriorResult(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1})
+  if err, result := game.MakeMoveWithID(userA, "win", 0, 2); err != nil ||
+      result != OWin {
+    t.Fatalf("winning move: %v, %s", err, result)
+  }
+  if err, result := game.MakeMoveWithID(userA, "win", 0, 2); err != nil ||
+      result != OWin {
+    t.Fatalf("retried winning move: %v, %s, want the prior %s", err,
+      result, OWin)
+  }
+}
+
+func TestMakeMoveWithIDAfterUndo(t *testing.T) {
+  game := startTestGame(t)
+  userA, userB := testUsers(t)
+  if err, _ := game.MakeMoveWithID(userA, "m1", 1, 1); err != nil {
+    t.Fatal(err)
+  }
+  if err, _ := game.MakeMoveWithID(userB, "m2", 0, 0); err != nil {
+    t.Fatal(err)
+  }
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+
+  if err, _ := game.MakeMoveWithID(userB, "m2", 0, 0); err != nil {
+    t.Fatal(err)
+  }
+  if game.board[0][0] != X || len(game.history) != 2 {
+    t.Fatalf("retry after Undo left %s at 0 0 with %d moves",
+      game.board[0][0], len(game.history))
+  }
+  // The move that was not undone is still only applied once.
+  if err, _ := game.MakeMoveWithID(userA, "m1", 1, 1); err != nil ||
+      len(game.history) != 2 {
+    t.Fatalf("retried m1: %v with %d moves, want 2", err,
+      len(game.history))
+  }
+}
+
+func TestAllGamesSortedByKey(t *testing.T) {
+  name := testName(t)
+  users := []string{name + "/a", name + "/b", name + "/c"}
+  mine := map[string]bool{}
+  for _, pair := range [][2]int{{1, 2}, {0, 2}, {0, 1}} {
+    game, err := startGame(users[pair[0]], users[pair[1]])
+    if err != nil {
+      t.Fatal(err)
+    }
+    mine[game.key] = true
+  }
+  game, _ := GetGame(users[0], users[1])
+  playMoves(t, game, [2]int{1, 1})
+
+  // Other tests' games may be listed too, so only this test's are checked.
+  var got []GameListing
+  all := AllGames()
+  for i, listing := range all {
+    if i > 0 && all[i - 1].Key >= listing.Key {
+      t.Fatalf("listings out of order: %q before %q", all[i - 1].Key,
+        listing.Key)
+    }
+    if mine[listing.Key] {
+      got = append(got, listing)
+    }
+  }
+  want := []GameListing{
+    {Key: getUserPairKey(users[0], users[1]), Current: users[1], Pieces: 1,
+      Result: Pending},
+    {Key: getUserPairKey(users[0], users[2]), Current: users[0],
+      Result: Pending},
+    {Key: getUserPairKey(users[1], users[2]), Current: users[1],
+      Result: Pending},
+  }
+  if !reflect.DeepEqual(got, want) {
+    t.Fatalf("AllGames() listed %+v, want %+v", got, want)
+  }
+}
+
+func TestSubscribersEachGetEveryMove(t *testing.T) {
+  game := startTestGame(t)
+  want := []Move{
+    {Piece: O, X: 0, Y: 0}, {Piece: X, X: 1, Y: 0}, {Piece: O, X: 0, Y: 1},
+    {Piece: X, X: 1, Y: 1}, {Piece: O, X: 0, Y: 2},
+  }
+
+  // Both subscribers drain their channels while the moves are made.
+  var wg sync.WaitGroup
+  got := make([][]Move, 2)
+  for i := range got {
+    moves := game.Subscribe()
+    wg.Add(1)
+    go func(i int) {
+      defer wg.Done()
+      for m := range moves {
+        got[i] = append(got[i], m)
+      }
+    }(i)
+  }
+  for _, m := range want {
+    playMoves(t, game, [2]int{m.X, m.Y})
+  }
+  wg.Wait()
+
+  for i := range got {
+    if !reflect.DeepEqual(got[i], want) {
+      t.Errorf("subscriber %d got %v, want %v", i, got[i], want)
+    }
+  }
+}
+
+func TestSubscribeAfterGameOver(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  game.Forfeit(userA)
+  if _, ok := <-game.Subscribe(); ok {
+    t.Fatal("subscriber to a finished game was sent a move")
+  }
+}
+
+func TestGameResultCode(t *testing.T) {
+  // The codes are fixed by the wire format, not by declaration order.
+  for r, want := range map[GameResult]int{
+    Pending: 0,
+    OWin: 1,
+    XWin: 2,
+    Tie: 3,
+    TWin: 4,
+  } {
+    if code := r.Code(); code != want {
+      t.Errorf("%s.Code() = %d, want %d", r, code, want)
+    }
+  }
+  if code := GameResult(-1).Code(); code != -1 {
+    t.Fatalf("unknown result has code %d, want -1", code)
+  }
+}
+
+func TestApplyMovesBatchWinningGame(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{2, 2})
+
+  err := game.ApplyMoves([]UserMove{{userB, 1, 0}, {userA, 0, 0},
+    {userB, 1, 1}, {userA, 0, 1}, {userB, 1, 2}})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if result := game.Result(); result != XWin {
+    t.Fatalf("result %s, want %s", result, XWin)
+  }
+  got := game.History()
+  if len(got) != 6 || got[0] != (Move{Piece: O, X: 2, Y: 2}) {
+    t.Fatalf("history %v, want the earlier move and all five", got)
+  }
+  if stats := GetStats(userB); stats.Wins != 1 {
+    t.Fatalf("stats %+v after a winning batch, want one win", stats)
+  }
+  if _, ok := GetGame(userA, userB); ok {
+    t.Fatal("game finished by a batch is still stored")
+  }
+
+  // Moves after the end fail the whole batch.
+  if err := game.ApplyMoves([]UserMove{{userA, 2, 0}}); !errors.Is(err,
+      ErrGameOver) {
+    t.Fatalf("got %v, want %v", err, ErrGameOver)
+  }
+}
+
+func TestMovesRemaining(t *testing.T) {
+  game := startTestGame(t)
+  if n := game.MovesRemaining(); n != 9 {
+    t.Fatalf("%d moves left on an empty board, want 9", n)
+  }
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{0, 2}, [2]int{2, 0})
+  if n := game.MovesRemaining(); n != 5 {
+    t.Fatalf("%d moves left mid-game, want 5", n)
+  }
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if n := game.MovesRemaining(); n != 6 {
+    t.Fatalf("%d moves left after Undo, want 6", n)
+  }
+  playMoves(t, game, [2]int{2, 0}, [2]int{1, 0}, [2]int{1, 2}, [2]int{0, 1},
+    [2]int{2, 1}, [2]int{2, 2})
+  if n := game.MovesRemaining(); n != 0 {
+    t.Fatalf("%d moves left on a full board, want 0", n)
+  }
+}
+
+func TestLoserUser(t *testing.T) {
+  userA, userB := testUsers(t)
+  for _, c := range []struct {
+    name string
+    moves [][2]int
+    loser string
+    lost bool
+  }{
+    {"pending", [][2]int{{1, 1}, {0, 0}}, "", false},
+    {"O win", [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}}, userB, true},
+    {"X win", [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 2}, {1, 2}},
+      userA, true},
+    {"tie", [][2]int{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0}, {1, 2}, {0, 1},
+      {2, 1}, {2, 2}}, "", false},
+  } {
+    game, err := newGame(userA, userB, boardSize)
+    if err != nil {
+      t.Fatal(err)
+    }
+    playMoves(t, game, c.moves...)
+    if loser, lost := game.LoserUser(); loser != c.loser || lost != c.lost {
+      t.Errorf("%s: LoserUser() = %q, %t, want %q, %t", c.name, loser, lost,
+        c.loser, c.lost)
+    }
+  }
+}
+
+func TestApplyPieRule(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+
+  if err := game.ApplyPieRule(userA); !errors.Is(err, ErrNotYourTurn) {
+    t.Fatalf("first player swapping: got %v, want %v", err, ErrNotYourTurn)
+  }
+  if err := game.ApplyPieRule(userB); err != nil {
+    t.Fatal(err)
+  }
+  if piece, _ := game.PieceOf(userB); piece != O {
+    t.Fatalf("%s plays %s after the swap, want %s", userB, piece, O)
+  }
+  if user, piece := game.CurrentPlayer(); user != userA || piece != X {
+    t.Fatalf("%s (%s) to move after the swap, want %s (%s)", user, piece,
+      userA, X)
+  }
+
+  // userB now owns the center, so completing the column wins for them.
+  playMoves(t, game, [2]int{0, 0}, [2]int{0, 1}, [2]int{2, 2})
+  if result := playMoves(t, game, [2]int{2, 1}); result != OWin {
+    t.Fatalf("result %s, want %s", result, OWin)
+  }
+  if winner, _ := game.WinnerUser(); winner != userB {
+    t.Fatalf("won by %q, want %q", winner, userB)
+  }
+}
+
+func TestApplyPieRuleTooLate(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  if err := game.ApplyPieRule(userB); err == nil {
+    t.Fatal("pie rule applied before the first move")
+  }
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0})
+  if err := game.ApplyPieRule(userA); err == nil {
+    t.Fatal("pie rule applied after the second move")
+  }
+  if piece, _ := game.PieceOf(userA); piece != O {
+    t.Fatalf("%s plays %s after a refused swap, want %s", userA, piece, O)
+  }
+}
+
+func TestUndoWinningMoveClearsWin(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  // The corner completes both the first row and the first column.
+  playMoves(t, game, [2]int{0, 1}, [2]int{1, 1}, [2]int{0, 2}, [2]int{2, 1},
+    [2]int{1, 0}, [2]int{1, 2}, [2]int{2, 0}, [2]int{2, 2}, [2]int{0, 0})
+  if game.WinLineCount() != 2 {
+    t.Fatalf("%d lines completed, want 2", game.WinLineCount())
+  }
+
+  if err := game.Undo(); err != nil {
+    t.Fatal(err)
+  }
+  if result := game.Result(); result != Pending {
+    t.Fatalf("result %s after undoing the win, want %s", result, Pending)
+  }
+  if line := game.WinningLine(); line != nil {
+    t.Fatalf("winning line %v after undoing the win", line)
+  }
+  if n := game.WinLineCount(); n != 0 {
+    t.Fatalf("%d lines completed after undoing the win, want 0", n)
+  }
+  if user, piece := game.CurrentPlayer(); user != userA || piece != O {
+    t.Fatalf("%s (%s) to move after Undo, want %s (%s)", user, piece, userA,
+      O)
+  }
+
+  // The game is playable again, with only the undone cell left.
+  if result := playMoves(t, game, [2]int{0, 0}); result != OWin {
+    t.Fatalf("result %s replaying the win, want %s", result, OWin)
+  }
+}
+
+func TestCheckWinFastAgreesWithCheckGameOver(t *testing.T) {
+  userA, userB := testUsers(t)
+  rng := rand.New(rand.NewSource(1))
+  for size := 3; size <= 6; size++ {
+    for _, winLength := range []int{3, size} {
+      for _, mode := range []GameMode{Normal, Misere} {
+        for i := 0; i < 200; i++ {
+          game, err := newGame(userA, userB, size)
+          if err != nil {
+            t.Fatal(err)
+          }
+          game.winLength, game.mode = winLength, mode
+
+          // Play random moves to the end, checking the result after each.
+          for game.result == Pending {
+            moves := validMoves(game)
+            m := moves[rng.Intn(len(moves))]
+            last := Move{Piece: game.currPiece, X: m[0], Y: m[1]}
+            err, result := applyMove(game, currPlayer(game), m[0], m[1])
+            if err != nil {
+              t.Fatal(err)
+            }
+            if fast := game.CheckWinFast(last); fast != result {
+              t.Fatalf("size %d, win length %d, mode %d: CheckWinFast(%+v) " +
+                "= %s, checkGameOver gave %s:\n%s", size, winLength, mode,
+                last, fast, result, game.board)
+            }
+          }
+        }
+      }
+    }
+  }
+}
+
+func TestCheckWinFastIgnoresMissingPiece(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  for _, last := range []Move{
+    {Piece: X, X: 0, Y: 2},
+    {Piece: O, X: 2, Y: 2},
+    {Piece: O, X: 3, Y: 0},
+    {Piece: B, X: 2, Y: 2},
+  } {
+    if result := game.CheckWinFast(last); result != Pending {
+      t.Errorf("CheckWinFast(%+v) = %s, want %s", last, result, Pending)
+    }
+  }
+  if result := game.CheckWinFast(Move{Piece: O, X: 0, Y: 1}); result != OWin {
+    t.Fatalf("CheckWinFast through the middle of the row = %s, want %s",
+      result, OWin)
+  }
+}
+
+// Sets up a size * size game with a run of O pieces one short of a win 
+// through the center in every direction, the worst case for scanning, and 
+// returns the center move.
+func benchmarkGame(b *testing.B, size int, winLength int) (*GameState,
+    Move) {
+  game, err := newGame("bench/a", "bench/b", size)
+  if err != nil {
+    b.Fatal(err)
+  }
+  game.winLength = winLength
+  c := size / 2
+  placePiece(game, O, c, c)
+  for _, d := range lineDirections {
+    for n := 1; n <= (winLength - 2) / 2; n++ {
+      for _, s := range []int{n, -n} {
+        x, y := c + s * d[0], c + s * d[1]
+        if onBoard(size, x, y) && game.board[x][y] == B {
+          placePiece(game, O, x, y)
+        }
+      }
+    }
+  }
+  return game, Move{Piece: O, X: c, Y: c}
+}
+
+func BenchmarkCheckWin(b *testing.B) {
+  for _, c := range []struct {
+    size, winLength int
+  }{
+    {3, 3},
+    {64, 5},
+    {64, 64},
+  } {
+    name := fmt.Sprintf("%dx%d/%d", c.size, c.size, c.winLength)
+    b.Run(name + "/CheckWinFast", func(b *testing.B) {
+      game, last := benchmarkGame(b, c.size, c.winLength)
+      b.ResetTimer()
+      for i := 0; i < b.N; i++ {
+        if game.CheckWinFast(last) != Pending {
+          b.Fatal("benchmark position is won")
+        }
+      }
+    })
+    b.Run(name + "/checkGameOver", func(b *testing.B) {
+      game, last := benchmarkGame(b, c.size, c.winLength)
+      b.ResetTimer()
+      for i := 0; i < b.N; i++ {
+        if checkGameOver(game, last.X, last.Y) != Pending {
+          b.Fatal("benchmark position is won")
+        }
+      }
+    })
+  }
+}
+
+func TestPieceOf(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  for _, c := range []struct {
+    user string
+    piece Piece
+  }{
+    {userA, O},
+    {userB, X},
+  } {
+    if piece, err := game.PieceOf(c.user); err != nil || piece != c.piece {
+      t.Errorf("PieceOf(%s) = %s, %v, want %s", c.user, piece, err, c.piece)
+    }
+  }
+  if piece, err := game.PieceOf(userA + "/other"); err == nil {
+    t.Fatalf("stranger plays %s", piece)
+  }
+}
+
+func TestPieceOfAfterFirstPlayerChoice(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameFirstPlayer(userA, userB, userB)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if piece, _ := game.PieceOf(userB); piece != O {
+    t.Fatalf("first player %s plays %s, want %s", userB, piece, O)
+  }
+  if piece, _ := game.PieceOf(userA); piece != X {
+    t.Fatalf("second player %s plays %s, want %s", userA, piece, X)
+  }
+}
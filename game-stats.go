@@ -0,0 +1,97 @@
+// Per-user win/loss/tie statistics for finished tictactoe games.
+package tictactoe
+
+import (
+  "sync"
+)
+
+// Counts of finished games for a single user.
+type Stats struct {
+  Wins, Losses, Ties int
+}
+
+// Statistics for every user who has finished a game, keyed by username.
+var userStats = map[string]*Stats{}
+
+// Guards all reads and writes of userStats.
+var userStatsMu sync.Mutex
+
+// Gets the statistics for user, which are all zero if they have never 
+// finished a game.
+func GetStats(user string) Stats {
+  userStatsMu.Lock()
+  defer userStatsMu.Unlock()
+  if stats, ok := userStats[user]; ok {
+    return *stats
+  }
+  return Stats{}
+}
+
+func getOrCreateStats(user string) *Stats {
+  stats, ok := userStats[user]
+  if !ok {
+    stats = &Stats{}
+    userStats[user] = stats
+  }
+  return stats
+}
+
+/**
+ * Records the result of a finished game in userStats, for callers holding 
+ * game.mu. A tie counts for every player, and a win counts as a loss for 
+ * every other player.
+ */
+func recordStats(game *GameState) {
+  addStats(game, 1)
+  game.counted = true
+}
+
+// Takes the result of a finished game recorded by recordStats back out of 
+// userStats, e.g. when the move that ended it is undone.
+func unrecordStats(game *GameState) {
+  addStats(game, -1)
+  game.counted = false
+}
+
+// Adds delta to the statistic each player's result counts towards.
+func addStats(game *GameState, delta int) {
+  userStatsMu.Lock()
+  defer userStatsMu.Unlock()
+
+  for i, user := range game.players {
+    stats := getOrCreateStats(user)
+    switch {
+    case game.result == Tie:
+      stats.Ties += delta
+    case winningPiece(game.result) == Piece(i):
+      stats.Wins += delta
+    default:
+      stats.Losses += delta
+    }
+  }
+}
+
+// Number of games started between each group of users, keyed like 
+// currentGames.
+var headToHead = map[string]int{}
+
+// Guards all reads and writes of headToHead.
+var headToHeadMu sync.Mutex
+
+// Counts a game started between its players in headToHead.
+func recordHeadToHead(game *GameState) {
+  headToHeadMu.Lock()
+  headToHead[game.key]++
+  headToHeadMu.Unlock()
+}
+
+/**
+ * Gets the number of games started between userA and userB, in either 
+ * order, whether or not they were finished. Every game stored in 
+ * currentGames counts, including ones loaded from saved boards.
+ */
+func HeadToHead(userA string, userB string) int {
+  headToHeadMu.Lock()
+  defer headToHeadMu.Unlock()
+  return headToHead[getUserPairKey(userA, userB)]
+}
@@ -0,0 +1,80 @@
+package tictactoe
+
+import (
+  "testing"
+)
+
+func TestStatsAccumulate(t *testing.T) {
+  userA, userB := testUsers(t)
+  oWin := [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}}
+  tie := [][2]int{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0}, {1, 2}, {0, 1},
+    {2, 1}, {2, 2}}
+
+  for _, g := range []struct {
+    first string
+    moves [][2]int
+  }{
+    {userA, oWin},
+    {userA, oWin},
+    {userB, oWin},
+    {userA, tie},
+  } {
+    game, err := StartGameFirstPlayer(userA, userB, g.first)
+    if err != nil {
+      t.Fatal(err)
+    }
+    playMoves(t, game, g.moves...)
+  }
+
+  if got, want := GetStats(userA), (Stats{Wins: 2, Losses: 1, Ties: 1});
+      got != want {
+    t.Errorf("%s stats %+v, want %+v", userA, got, want)
+  }
+  if got, want := GetStats(userB), (Stats{Wins: 1, Losses: 2, Ties: 1});
+      got != want {
+    t.Errorf("%s stats %+v, want %+v", userB, got, want)
+  }
+}
+
+func TestStatsSkipForfeitsAndClears(t *testing.T) {
+  userA, userB := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  game.Forfeit(userA)
+
+  game = startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  ClearGamesForUser(userB)
+
+  for _, user := range []string{userA, userB} {
+    if stats := GetStats(user); stats != (Stats{}) {
+      t.Errorf("%s stats %+v, want none", user, stats)
+    }
+  }
+}
+
+func TestStatsForUnknownUser(t *testing.T) {
+  if stats := GetStats(testName(t)); stats != (Stats{}) {
+    t.Fatalf("stats %+v for a user who never played", stats)
+  }
+}
+
+func TestHeadToHead(t *testing.T) {
+  userA, userB := testUsers(t)
+  if n := HeadToHead(userA, userB); n != 0 {
+    t.Fatalf("%d games before any were started, want 0", n)
+  }
+  for _, users := range [][2]string{{userA, userB}, {userB, userA},
+      {userA, userB}} {
+    if _, err := startGame(users[0], users[1]); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if a, b := HeadToHead(userA, userB), HeadToHead(userB, userA); a != 3 ||
+      b != 3 {
+    t.Fatalf("HeadToHead = %d and %d by argument order, want 3", a, b)
+  }
+  if n := HeadToHead(userA, userA + "/other"); n != 0 {
+    t.Fatalf("%d games against a new opponent, want 0", n)
+  }
+}
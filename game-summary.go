@@ -0,0 +1,112 @@
+// Summaries of finished tictactoe games for logging and storage.
+package tictactoe
+
+import (
+  "fmt"
+  "sort"
+)
+
+// The outcome of a game, along with the moves that led to it.
+type GameSummary struct {
+  // Username of the winning player, empty if the game had no winner.
+  Winner string
+  Result GameResult
+  // Moves played in order, including Forced pieces placed by ForceMove.
+  Moves []Move
+  TotalPieces int
+  // Usernames of the players in turn order, holding O, X, and then T.
+  Players []string
+  // The number of rows and columns on the board.
+  Size int
+  // The rules variant played.
+  Mode GameMode
+  // The number of consecutive pieces completing a line, or 0 for a full 
+  // row, column, or diagonal.
+  WinLength int
+}
+
+// Gets a summary of the game so far.
+func (g *GameState) Summary() GameSummary {
+  g.mu.Lock()
+  defer g.mu.Unlock()
+
+  summary := GameSummary{
+    Result: g.result,
+    Moves: append([]Move(nil), g.history...),
+    TotalPieces: g.totalPieces,
+    Players: append([]string(nil), g.players...),
+    Size: g.size,
+    Mode: g.mode,
+    WinLength: g.winLength,
+  }
+  summary.Winner, _ = winnerUser(g)
+  return summary
+}
+
+/**
+ * Replays the moves of a summarized game, returning an independent snapshot 
+ * of the game after each move, starting from an empty board. Forced moves 
+ * are placed like ForceMove, regardless of turn order. The game is 
+ * replayed with the summary's mode and win length, but win conditions are 
+ * not part of a summary, so a game that one of them ended is replayed 
+ * without that ending. Returns an error if the win length is out of range, 
+ * a move is illegal, or any other move is made out of turn.
+ */
+func ReplaySteps(summary GameSummary) ([]*GameState, error) {
+  game, err := newGameUsers(summary.Players, summary.Size)
+  if err != nil {
+    return nil, err
+  }
+  game.mode = summary.Mode
+  if summary.WinLength != 0 {
+    if summary.WinLength < minBoardSize || summary.WinLength > game.size {
+      return nil, fmt.Errorf("Win length %d must be between %d and the " +
+        "board size %d.", summary.WinLength, minBoardSize, game.size)
+    }
+    game.winLength = summary.WinLength
+  }
+
+  steps := make([]*GameState, 0, len(summary.Moves))
+  for i, m := range summary.Moves {
+    if m.Forced {
+      if err := forceMove(game, m.Piece, m.X, m.Y); err != nil {
+        return nil, fmt.Errorf("move %d: %w", i + 1, err)
+      }
+      steps = append(steps, game.clone())
+      continue
+    }
+    if m.Piece != game.currPiece {
+      return nil, fmt.Errorf("move %d: %w", i + 1, ErrNotYourTurn)
+    }
+    if err, _ := applyMove(game, currPlayer(game), m.X, m.Y); err != nil {
+      return nil, fmt.Errorf("move %d: %w", i + 1, err)
+    }
+    steps = append(steps, game.clone())
+  }
+  return steps, nil
+}
+
+/**
+ * Gets summaries of the games in currentGames that are over, in key order. 
+ * Finished games are only kept in currentGames, and so listed here, while 
+ * SetRetainFinishedGames is on.
+ */
+func FinishedGames() []GameSummary {
+  currentGamesMu.RLock()
+  keys := make([]string, 0, len(currentGames))
+  games := make(map[string]*GameState, len(currentGames))
+  for key, game := range currentGames {
+    keys = append(keys, key)
+    games[key] = game
+  }
+  currentGamesMu.RUnlock()
+
+  sort.Strings(keys)
+  summaries := []GameSummary{}
+  for _, key := range keys {
+    if summary := games[key].Summary(); summary.Result != Pending {
+      summaries = append(summaries, summary)
+    }
+  }
+  return summaries
+}
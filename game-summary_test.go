@@ -0,0 +1,170 @@
+package tictactoe
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestReplayStepsForcedMoves(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1})
+  if err := game.ForceMove(X, 0, 0); err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 2})
+
+  steps, err := ReplaySteps(game.Summary())
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(steps) != 3 {
+    t.Fatalf("%d steps, want 3", len(steps))
+  }
+  if diffs := Diff(steps[2], game); len(diffs) != 0 {
+    t.Fatalf("replayed game differs: %v", diffs)
+  }
+}
+
+func TestSummaryOfWin(t *testing.T) {
+  userA, _ := testUsers(t)
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+
+  summary := game.Summary()
+  if summary.Result != OWin || summary.Winner != userA {
+    t.Fatalf("result %s won by %q, want %s won by %q", summary.Result,
+      summary.Winner, OWin, userA)
+  }
+  if summary.TotalPieces != 5 || len(summary.Moves) != 5 {
+    t.Fatalf("%d pieces and %d moves, want 5 of each", summary.TotalPieces,
+      len(summary.Moves))
+  }
+  if m := summary.Moves[4]; m != (Move{Piece: O, X: 0, Y: 2}) {
+    t.Fatalf("last move %+v, want O at 0 2", m)
+  }
+}
+
+func TestSummaryOfTieHasNoWinner(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{1, 1}, [2]int{0, 0}, [2]int{0, 2}, [2]int{2, 0},
+    [2]int{1, 0}, [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 1}, [2]int{2, 2})
+  if summary := game.Summary(); summary.Result != Tie ||
+      summary.Winner != "" {
+    t.Fatalf("result %s won by %q, want a %s without a winner",
+      summary.Result, summary.Winner, Tie)
+  }
+}
+
+func TestReplayStepsGrowsByOnePiece(t *testing.T) {
+  game := startTestGame(t)
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+
+  steps, err := ReplaySteps(game.Summary())
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(steps) != 5 {
+    t.Fatalf("%d steps, want 5", len(steps))
+  }
+  for i, step := range steps {
+    pieces := 0
+    for _, row := range step.board {
+      for _, p := range row {
+        if p != B {
+          pieces++
+        }
+      }
+    }
+    if pieces != i + 1 || step.totalPieces != i + 1 {
+      t.Errorf("step %d has %d pieces and totalPieces %d, want %d", i, pieces,
+        step.totalPieces, i + 1)
+    }
+  }
+  if steps[4].result != OWin {
+    t.Fatalf("last step result %s, want %s", steps[4].result, OWin)
+  }
+
+  // Each step is a snapshot of its own.
+  steps[0].board[2][2] = X
+  if steps[1].board[2][2] != B {
+    t.Fatal("changing one step changed the next")
+  }
+}
+
+func TestReplayStepsFollowsModeAndWinLength(t *testing.T) {
+  userA, userB := testUsers(t)
+  game, err := StartGameMode(userA, userB, Misere)
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  steps, err := ReplaySteps(game.Summary())
+  if err != nil {
+    t.Fatal(err)
+  }
+  if diffs := Diff(steps[len(steps) - 1], game); len(diffs) != 0 {
+    t.Fatalf("replayed Misere game differs: %v", diffs)
+  }
+
+  if game, err = StartGameWinLength(userA, userB, 5, 3); err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, game, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  summary := game.Summary()
+  if steps, err = ReplaySteps(summary); err != nil {
+    t.Fatal(err)
+  }
+  if diffs := Diff(steps[len(steps) - 1], game); len(diffs) != 0 {
+    t.Fatalf("replayed game with win length 3 differs: %v", diffs)
+  }
+
+  summary.WinLength = 6
+  if _, err := ReplaySteps(summary); err == nil {
+    t.Fatal("replayed a game with win length 6 on a 5x5 board")
+  }
+}
+
+func TestFinishedGamesSkipsPendingGames(t *testing.T) {
+  SetRetainFinishedGames(true)
+  defer SetRetainFinishedGames(false)
+
+  name := testName(t)
+  users := []string{name + "/a", name + "/b", name + "/c"}
+  won, err := startGame(users[0], users[1])
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, won, [2]int{0, 0}, [2]int{1, 0}, [2]int{0, 1}, [2]int{1, 1},
+    [2]int{0, 2})
+  pending, err := startGame(users[0], users[2])
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, pending, [2]int{1, 1})
+  tied, err := startGame(users[1], users[2])
+  if err != nil {
+    t.Fatal(err)
+  }
+  playMoves(t, tied, [2]int{1, 1}, [2]int{0, 0}, [2]int{0, 2}, [2]int{2, 0},
+    [2]int{1, 0}, [2]int{1, 2}, [2]int{0, 1}, [2]int{2, 1}, [2]int{2, 2})
+
+  // Other tests' games may be listed too, so only this test's are checked.
+  var got []GameResult
+  for _, summary := range FinishedGames() {
+    if summary.Result == Pending {
+      t.Fatalf("pending game listed: %+v", summary)
+    }
+    for _, user := range users {
+      if summary.Players[0] == user {
+        got = append(got, summary.Result)
+      }
+    }
+  }
+  if want := []GameResult{OWin, Tie}; !reflect.DeepEqual(got, want) {
+    t.Fatalf("finished results %v, want %v", got, want)
+  }
+}
@@ -0,0 +1,75 @@
+// Symmetries of tictactoe boards under rotation and reflection.
+package tictactoe
+
+// Gets a copy of the board rotated 90 degrees clockwise.
+func (b Board) rotate() Board {
+  n := len(b)
+  r := newBoard(n)
+  for i := 0; i < n; i++ {
+    for j := 0; j < n; j++ {
+      r[i][j] = b[n - 1 - j][i]
+    }
+  }
+  return r
+}
+
+// Gets a copy of the board mirrored left to right.
+func (b Board) reflect() Board {
+  n := len(b)
+  r := newBoard(n)
+  for i := 0; i < n; i++ {
+    for j := 0; j < n; j++ {
+      r[i][j] = b[i][n - 1 - j]
+    }
+  }
+  return r
+}
+
+/**
+ * Gets the eight boards equivalent to this one under rotation and 
+ * reflection: the board itself and its 90, 180, and 270 degree clockwise 
+ * rotations, followed by the mirror images of each. All are copies.
+ */
+func (b Board) Symmetries() [8]Board {
+  var syms [8]Board
+  syms[0] = b.clone()
+  for i := 1; i < 4; i++ {
+    syms[i] = syms[i - 1].rotate()
+  }
+  for i := 0; i < 4; i++ {
+    syms[i + 4] = syms[i].reflect()
+  }
+  return syms
+}
+
+// Compares boards of the same size cell by cell in row-major order, 
+// returning -1, 0, or 1 as a is less than, equal to, or greater than b.
+func compareBoards(a Board, b Board) int {
+  for i := range a {
+    for j := range a[i] {
+      switch {
+      case a[i][j] < b[i][j]:
+        return -1
+      case a[i][j] > b[i][j]:
+        return 1
+      }
+    }
+  }
+  return 0
+}
+
+/**
+ * Gets the canonical form of the board, the lexicographically smallest of 
+ * its Symmetries in row-major order. Boards that are rotations or 
+ * reflections of each other have the same canonical form.
+ */
+func (b Board) Canonical() Board {
+  syms := b.Symmetries()
+  best := syms[0]
+  for _, s := range syms[1:] {
+    if compareBoards(s, best) < 0 {
+      best = s
+    }
+  }
+  return best
+}
@@ -0,0 +1,57 @@
+package tictactoe
+
+import (
+  "reflect"
+  "testing"
+)
+
+func TestRotationHasSameCanonicalForm(t *testing.T) {
+  board := Board{{O, X, B}, {B, O, B}, {B, B, X}}
+  rotated := Board{{B, B, O}, {B, O, X}, {X, B, B}}
+  if got := board.rotate(); !reflect.DeepEqual(got, rotated) {
+    t.Fatalf("rotate() =\n%s\nwant\n%s", got, rotated)
+  }
+  if a, b := board.Canonical(), rotated.Canonical(); !reflect.DeepEqual(a, b) {
+    t.Fatalf("canonical forms differ:\n%s\n%s", a, b)
+  }
+}
+
+func TestSymmetriesShareCanonicalForm(t *testing.T) {
+  board := Board{{O, X, B, B}, {B, O, B, X}, {B, B, B, B}, {X, B, B, O}}
+  want := board.Canonical()
+  for i, s := range board.Symmetries() {
+    if got := s.Canonical(); !reflect.DeepEqual(got, want) {
+      t.Errorf("symmetry %d has canonical form\n%s\nwant\n%s", i, got, want)
+    }
+  }
+}
+
+func TestSymmetriesAreCopies(t *testing.T) {
+  board := Board{{O, B, B}, {B, B, B}, {B, B, B}}
+  syms := board.Symmetries()
+  syms[0][0][0] = X
+  if board[0][0] != O {
+    t.Fatal("changing a symmetry changed the board")
+  }
+
+  // A corner piece lands on each of the four corners.
+  corners := map[[2]int]bool{}
+  for _, s := range board.Symmetries() {
+    for _, c := range [][2]int{{0, 0}, {0, 2}, {2, 0}, {2, 2}} {
+      if s[c[0]][c[1]] == O {
+        corners[c] = true
+      }
+    }
+  }
+  if len(corners) != 4 {
+    t.Fatalf("corner piece reached %d corners, want 4", len(corners))
+  }
+}
+
+func TestCanonicalDistinguishesBoards(t *testing.T) {
+  corner := Board{{O, B, B}, {B, B, B}, {B, B, B}}
+  edge := Board{{B, O, B}, {B, B, B}, {B, B, B}}
+  if reflect.DeepEqual(corner.Canonical(), edge.Canonical()) {
+    t.Fatal("corner and edge openings have the same canonical form")
+  }
+}